@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// findBlockJSONFiles returns the paths relative to workDir of all block.json
+// files that are part of the plugin. Dependencies are never searched.
+func findBlockJSONFiles(workDir string, skipPatterns []string) ([]string, error) {
+	files, err := collectZipFiles(workDir, append([]string{"node_modules", "vendor"}, skipPatterns...))
+	if err != nil {
+		return nil, err
+	}
+	var blocks []string
+	for _, relPath := range files {
+		if filepath.Base(relPath) == "block.json" {
+			blocks = append(blocks, relPath)
+		}
+	}
+	return blocks, nil
+}
+
+// syncBlockVersions sets the version field of every block.json to version,
+// which WordPress uses to bust the cache of the block assets. A missing field
+// is added as the first field.
+func syncBlockVersions(workDir string, skipPatterns []string, version string) error {
+	blocks, err := findBlockJSONFiles(workDir, skipPatterns)
+	if err != nil {
+		return fmt.Errorf(t("error.walk_files"), err)
+	}
+	for _, relPath := range blocks {
+		path := filepath.Join(workDir, relPath)
+		logOpenedFile(path)
+		content, err := readReleaseFile(path)
+		if err != nil {
+			return fmt.Errorf("%s", t("error.block_json_read", relPath, err))
+		}
+		updated, err := setBlockVersion(string(content), version)
+		if err != nil {
+			return fmt.Errorf("%s", t("error.block_json_read", relPath, err))
+		}
+		if updated == string(content) {
+			continue
+		}
+		if err := writeReleaseFile(path, []byte(updated), 0644); err != nil {
+			return err
+		}
+		logVerbose(t("log.block_version_updated", relPath, version))
+	}
+	return nil
+}
+
+// setBlockVersion replaces or adds the top level version of a block.json
+// without reformatting it.
+func setBlockVersion(content string, version string) (string, error) {
+	if start, end, ok := findJSONStringValue(content, []string{"version"}); ok {
+		return content[:start] + version + content[end:], nil
+	}
+	open := strings.Index(content, "{")
+	if open < 0 {
+		return "", fmt.Errorf("%s", t("error.block_json_object"))
+	}
+	indent := "\t"
+	if m := regexp.MustCompile(`\n([ \t]+)"`).FindStringSubmatch(content[open:]); m != nil {
+		indent = m[1]
+	}
+	return content[:open+1] + "\n" + indent + `"version": "` + version + `",` + content[open+1:], nil
+}
+
+// checkBlockAssets fails if a wp-scripts asset manifest build/<dir>/*.asset.php
+// is older than a source file in src/<dir>, i.e. the blocks were changed but
+// not built. block.json is ignored, its version is set by the release itself.
+func checkBlockAssets(workDir string) error {
+	buildDir := filepath.Join(workDir, "build")
+	srcDir := filepath.Join(workDir, "src")
+	if !fileExists(buildDir) || !fileExists(srcDir) {
+		return nil
+	}
+	return filepath.WalkDir(buildDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".asset.php") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		relDir, err := filepath.Rel(buildDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		newest, newestTime, err := newestSourceFile(filepath.Join(srcDir, relDir))
+		if err != nil {
+			return err
+		}
+		if newestTime.After(info.ModTime()) {
+			relAsset, _ := filepath.Rel(workDir, path)
+			relSource, _ := filepath.Rel(workDir, newest)
+			return fmt.Errorf("%s", t("error.block_assets_outdated", relAsset, relSource))
+		}
+		return nil
+	})
+}
+
+// newestSourceFile returns the most recently modified file below dir other
+// than block.json. A missing dir has no files.
+func newestSourceFile(dir string) (string, time.Time, error) {
+	var newest string
+	var newestTime time.Time
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return "", newestTime, nil
+	}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == "block.json" {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newestTime) {
+			newest, newestTime = path, info.ModTime()
+		}
+		return nil
+	})
+	return newest, newestTime, err
+}
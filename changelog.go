@@ -89,11 +89,11 @@ func findVersionSectionRange(markdown string, version string) (start int, end in
 
 func readChangelog(workDir string, version string) (string, error) {
 	changelogPath := changelogPathForWorkDir(workDir)
-	if _, err := os.Stat(changelogPath); os.IsNotExist(err) {
+	if !releaseFileExists(changelogPath) {
 		return "", nil
 	}
 
-	content, err := os.ReadFile(changelogPath)
+	content, err := readReleaseFile(changelogPath)
 	if err != nil {
 		return "", err
 	}
@@ -125,10 +125,10 @@ func writeChangelog(workDir string, version string, content string) error {
 		return nil
 	}
 
-	if _, err := os.Stat(changelogPath); os.IsNotExist(err) {
+	if !releaseFileExists(changelogPath) {
 		newContent = fmt.Sprintf("# Changelog\n\n## [%s] - %s\n\n%s\n", version, currentDate, bullets)
 	} else {
-		data, err := os.ReadFile(changelogPath)
+		data, err := readReleaseFile(changelogPath)
 		if err != nil {
 			return err
 		}
@@ -164,15 +164,11 @@ func writeChangelog(workDir string, version string, content string) error {
 			changelogHeaderRegex := regexp.MustCompile(`(?im)^#\s*Changelog\s*\n`)
 			headerMatch := changelogHeaderRegex.FindStringIndex(existingContent)
 			if headerMatch != nil {
-				headerEnd := strings.Index(existingContent[headerMatch[1]:], "\n")
-				if headerEnd >= 0 {
-					headerEnd += headerMatch[1] + 1
-				} else {
-					headerEnd = headerMatch[1]
-				}
-				newContent = existingContent[:headerEnd] +
-					fmt.Sprintf("\n## [%s] - %s\n\n%s\n\n", version, currentDate, bullets) +
-					existingContent[headerEnd:]
+				// The match already ends behind the title and its blank
+				// lines, so the new section goes above the latest version.
+				newContent = strings.TrimRight(existingContent[:headerMatch[1]], "\r\n") +
+					fmt.Sprintf("\n\n## [%s] - %s\n\n%s\n\n", version, currentDate, bullets) +
+					existingContent[headerMatch[1]:]
 			} else {
 				newContent = fmt.Sprintf("# Changelog\n\n## [%s] - %s\n\n%s\n\n%s", version, currentDate, bullets, existingContent)
 			}
@@ -181,7 +177,40 @@ func writeChangelog(workDir string, version string, content string) error {
 
 	newContent = strings.ReplaceAll(newContent, "\r\n", "\n")
 	newContent = strings.TrimRight(newContent, "\n") + "\n\n"
-	return os.WriteFile(changelogPath, []byte(newContent), 0644)
+	return writeReleaseFile(changelogPath, []byte(newContent), 0644)
+}
+
+// writeChangelogHeader makes sure Changelog.md has a section for version. An
+// existing "## [Unreleased]" section is renamed, otherwise an empty section is
+// added below the "# Changelog" title.
+func writeChangelogHeader(workDir string, version string) error {
+	changelogPath := changelogPathForWorkDir(workDir)
+	header := fmt.Sprintf("## [%s] - %s", version, time.Now().Format("2006-01-02"))
+
+	existingContent := "# Changelog\n"
+	if releaseFileExists(changelogPath) {
+		data, err := readReleaseFile(changelogPath)
+		if err != nil {
+			return err
+		}
+		existingContent = strings.ReplaceAll(string(data), "\r\n", "\n")
+	}
+	if _, _, _, ok := findVersionSectionRange(existingContent, version); ok {
+		return nil
+	}
+
+	var newContent string
+	unreleasedRegex := regexp.MustCompile(`(?im)^##\s*\[?unreleased\]?[^\n]*$`)
+	if m := unreleasedRegex.FindStringIndex(existingContent); m != nil {
+		newContent = existingContent[:m[0]] + header + existingContent[m[1]:]
+	} else if m := regexp.MustCompile(`(?im)^#\s*Changelog\s*\n`).FindStringIndex(existingContent); m != nil {
+		newContent = existingContent[:m[1]] + "\n" + header + "\n\n" + existingContent[m[1]:]
+	} else {
+		newContent = "# Changelog\n\n" + header + "\n\n" + existingContent
+	}
+
+	newContent = strings.TrimRight(newContent, "\n") + "\n\n"
+	return writeReleaseFile(changelogPath, []byte(newContent), 0644)
 }
 
 func getChangedFiles(workDir string) ([]string, error) {
@@ -207,7 +236,14 @@ func getChangedFiles(workDir string) ([]string, error) {
 	return []string{}, nil
 }
 
+// nonInteractive disables all prompts, e.g. while plugins of a workspace are
+// released in parallel.
+var nonInteractive bool
+
 func isInteractiveTerminal() bool {
+	if nonInteractive {
+		return false
+	}
 	fileInfo, err := os.Stdin.Stat()
 	if err != nil {
 		return false
@@ -234,8 +270,8 @@ func promptChangelogText(version string, existingText string, changedFiles []str
 	}
 
 	if preview.Len() > 0 {
-		fmt.Println(t("prompt.changelog_preview"))
-		fmt.Println(preview.String())
+		fmt.Fprintln(console, t("prompt.changelog_preview"))
+		fmt.Fprintln(console, preview.String())
 	}
 
 	if os.Getenv("SKIP_CHANGELOG_INPUT") != "" || os.Getenv("AUTO_CHANGELOG") != "" {
@@ -255,7 +291,7 @@ func promptChangelogText(version string, existingText string, changedFiles []str
 		return "", nil
 	}
 
-	fmt.Print(t("prompt.changelog_text", version))
+	fmt.Fprint(console, t("prompt.changelog_text", version))
 	reader := bufio.NewReader(os.Stdin)
 	input, err := reader.ReadString('\n')
 	if err != nil {
@@ -281,6 +317,7 @@ func processChangelog(workDir string, version string, textOverride string) (stri
 	if err != nil {
 		logAndPrint(t("error.changelog_read", err))
 	}
+	existingText = stripUpgradeNotice(existingText)
 
 	changedFiles, err := getChangedFiles(workDir)
 	if err != nil {
@@ -321,7 +358,7 @@ func buildChangelogDLFromFile(workDir string, maxEntries int) (string, error) {
 		return "", nil
 	}
 	p := changelogPathForWorkDir(workDir)
-	data, err := os.ReadFile(p) // # nosec G304
+	data, err := readReleaseFile(p)
 	if err != nil {
 		return "", err
 	}
@@ -336,8 +373,20 @@ func buildChangelogDLFromFile(workDir string, maxEntries int) (string, error) {
 	}
 	var entries []entry
 	var cur *entry
+	inNotice := false
 	for _, raw := range lines {
 		line := strings.TrimRight(raw, " \t")
+		// The upgrade notice goes to upgrade_notice, not into the changelog.
+		if upgradeNoticeHeading.MatchString(line) {
+			inNotice = true
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			inNotice = false
+		}
+		if inNotice {
+			continue
+		}
 		if strings.HasPrefix(line, "## ") {
 			h := strings.TrimSpace(strings.TrimPrefix(line, "## "))
 			entries = append(entries, entry{header: h})
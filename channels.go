@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// channelUpdateInfoFile returns the name of the update_info file of a channel
+// in the Updates directory. The default channel uses update_info.json.
+func channelUpdateInfoFile(config *ConfigType, channel string) (string, error) {
+	if channel == "" {
+		return "update_info.json", nil
+	}
+	channelConfig, ok := config.Channels[channel]
+	if !ok {
+		if channel == "stable" {
+			return "update_info.json", nil
+		}
+		return "", fmt.Errorf("%s", t("error.channel_unknown", channel))
+	}
+	name := channelConfig.UpdateInfoFile
+	if name == "" {
+		name = "update_info-" + channel + ".json"
+	}
+	if filepath.Base(name) != name || !strings.HasSuffix(name, ".json") {
+		return "", fmt.Errorf("%s", t("error.channel_update_info_file", channel, name))
+	}
+	return name, nil
+}
+
+// loadChannelUpdateInfo reads the update_info file of the channel. A channel
+// feed that does not exist yet starts as a copy of update_info.json.
+func loadChannelUpdateInfo(workDir string, config *ConfigType, channel string) (string, *UpdateInfo, map[string]interface{}, error) {
+	name, err := channelUpdateInfoFile(config, channel)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	updateInfoPath := filepath.Join(workDir, "Updates", name)
+	stablePath := filepath.Join(workDir, "Updates", "update_info.json")
+
+	sourcePath := updateInfoPath
+	if !releaseFileExists(updateInfoPath) {
+		sourcePath = stablePath
+		logAndPrint(t("log.channel_new_feed", name))
+	}
+	updateInfo, allData, err := getUpdateInfo(sourcePath)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if channelConfig, ok := config.Channels[channel]; ok && channelConfig.DownloadPath != "" {
+		// A relative download path is always resolved against the stable feed,
+		// so repeated releases do not nest it.
+		baseURL := updateInfo.DownloadURL
+		if sourcePath != stablePath && !isAbsoluteURL(channelConfig.DownloadPath) {
+			stableInfo, _, err := getUpdateInfo(stablePath)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			baseURL = stableInfo.DownloadURL
+		}
+		downloadURL, err := channelDownloadURL(baseURL, channelConfig.DownloadPath, filepath.Base(updateInfo.DownloadURL))
+		if err != nil {
+			return "", nil, nil, err
+		}
+		updateInfo.DownloadURL = downloadURL
+	}
+	if channel != "" {
+		logVerbose(t("log.channel_selected", channel, name, redactSensitiveURL(updateInfo.DownloadURL)))
+	}
+	return updateInfoPath, updateInfo, allData, nil
+}
+
+func isAbsoluteURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.IsAbs()
+}
+
+// channelDownloadURL places zipName in the channel's download path. The path
+// is either an absolute URL or relative to the directory of baseURL, e.g.
+// "beta/".
+func channelDownloadURL(baseURL string, downloadPath string, zipName string) (string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	dir, err := url.Parse(strings.TrimSuffix(downloadPath, "/") + "/")
+	if err != nil {
+		return "", err
+	}
+	resolved := base.ResolveReference(dir)
+	resolved.Path += zipName
+	resolved.RawQuery = base.RawQuery
+	return resolved.String(), nil
+}
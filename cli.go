@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// cliOptions holds the parsed command line.
+type cliOptions struct {
+	command       string
+	workDir       string
+	fetchHostKey  bool
+	commitMessage string
+	bumpLevel     string
+	upgradeNotice string
+	channel       string
+	workspace     string
+	parallel      int
+	jsonOutput    bool
+	reportFile    string
+	initUpdateURL string
+	initSSH       string
+	initSSHDir    string
+	verbose       bool
+	dryRun        bool
+	showHelp      bool
+	showVersion   bool
+}
+
+// cliCommand is a subcommand that runs one or more stages of the pipeline.
+// init has no run function, it works before update.config exists.
+type cliCommand struct {
+	name    string
+	descKey string
+	run     func(*releaseContext) error
+}
+
+var cliCommands = []cliCommand{
+	{"release", "cli.command.release", runRelease},
+	{"bump", "cli.command.bump", runBump},
+	{"changelog", "cli.command.changelog", runChangelog},
+	{"zip", "cli.command.zip", runZip},
+	{"upload", "cli.command.upload", runUpload},
+	{"status", "cli.command.status", runStatus},
+	{"verify", "cli.command.verify", runVerify},
+	{"validate", "cli.command.validate", runValidate},
+	{"init", "cli.command.init", nil},
+}
+
+func findCommand(name string) *cliCommand {
+	for i := range cliCommands {
+		if cliCommands[i].name == name {
+			return &cliCommands[i]
+		}
+	}
+	return nil
+}
+
+// parseCLIArgs parses "[command] [options] [plugin directory]". Options may
+// appear before or after the directory, unknown options are an error. Without
+// a command the complete release is run.
+func parseCLIArgs(args []string) (*cliOptions, error) {
+	opts := &cliOptions{command: "release"}
+
+	var cleaned []string
+	for _, a := range args {
+		if a = strings.TrimSpace(a); a != "" {
+			cleaned = append(cleaned, a)
+		}
+	}
+	if len(cleaned) > 0 && findCommand(cleaned[0]) != nil {
+		opts.command = cleaned[0]
+		cleaned = cleaned[1:]
+	}
+
+	fs := flag.NewFlagSet("wp_plugin_release", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.fetchHostKey, "fetch-hostkey", false, "")
+	fs.BoolVar(&opts.fetchHostKey, "trustserver", false, "")
+	fs.BoolVar(&opts.verbose, "v", false, "")
+	fs.BoolVar(&opts.verbose, "verbose", false, "")
+	fs.StringVar(&opts.commitMessage, "c", "", "")
+	fs.StringVar(&opts.commitMessage, "commit", "", "")
+	fs.StringVar(&opts.bumpLevel, "bump", "", "")
+	fs.StringVar(&opts.upgradeNotice, "upgrade-notice", "", "")
+	fs.StringVar(&opts.channel, "channel", "", "")
+	fs.StringVar(&opts.workspace, "workspace", "", "")
+	fs.IntVar(&opts.parallel, "parallel", 0, "")
+	fs.BoolVar(&opts.jsonOutput, "json", false, "")
+	fs.StringVar(&opts.reportFile, "report", "", "")
+	fs.StringVar(&opts.initUpdateURL, "update-url", "", "")
+	fs.StringVar(&opts.initSSH, "ssh", "", "")
+	fs.StringVar(&opts.initSSHDir, "ssh-dir", "", "")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "")
+	fs.BoolVar(&opts.dryRun, "dryrun", false, "")
+	fs.BoolVar(&opts.showHelp, "h", false, "")
+	fs.BoolVar(&opts.showHelp, "help", false, "")
+	fs.BoolVar(&opts.showVersion, "version", false, "")
+
+	var positional []string
+	for {
+		if err := fs.Parse(cleaned); err != nil {
+			return nil, err
+		}
+		cleaned = fs.Args()
+		if len(cleaned) == 0 {
+			break
+		}
+		positional = append(positional, cleaned[0])
+		cleaned = cleaned[1:]
+	}
+
+	// "bump minor /path" takes the level as the first argument.
+	if opts.command == "bump" && len(positional) > 0 && isBumpLevel(positional[0]) {
+		opts.bumpLevel = positional[0]
+		positional = positional[1:]
+	}
+	if opts.bumpLevel != "" && !isBumpLevel(opts.bumpLevel) {
+		return nil, fmt.Errorf("%s", t("error.bump_level", opts.bumpLevel))
+	}
+
+	if len(positional) > 1 {
+		return nil, fmt.Errorf("%s", t("error.cli_too_many_args", strings.Join(positional[1:], " ")))
+	}
+	if len(positional) == 1 {
+		if opts.workspace != "" {
+			return nil, fmt.Errorf("%s", t("error.cli_workspace_dir", positional[0]))
+		}
+		opts.workDir = positional[0]
+	}
+	if opts.command == "init" && opts.workspace != "" {
+		return nil, fmt.Errorf("%s", t("error.cli_init_workspace"))
+	}
+	if opts.parallel < 0 {
+		return nil, fmt.Errorf("%s", t("error.cli_parallel", opts.parallel))
+	}
+	opts.commitMessage = strings.TrimSpace(opts.commitMessage)
+	return opts, nil
+}
+
+func usageText() string {
+	var b strings.Builder
+	b.WriteString(t("cli.usage"))
+	b.WriteString("\n\n")
+	b.WriteString(t("cli.commands"))
+	b.WriteString("\n")
+	for _, c := range cliCommands {
+		b.WriteString(fmt.Sprintf("  %-10s %s\n", c.name, t(c.descKey)))
+	}
+	b.WriteString("\n")
+	b.WriteString(t("cli.options"))
+	b.WriteString("\n")
+	options := [][2]string{
+		{"-bump <level>", "cli.option.bump"},
+		{"-c, -commit <text>", "cli.option.commit"},
+		{"-upgrade-notice <text>", "cli.option.upgrade_notice"},
+		{"-channel <name>", "cli.option.channel"},
+		{"-dry-run", "cli.option.dry_run"},
+		{"-workspace <file>", "cli.option.workspace"},
+		{"-parallel <n>", "cli.option.parallel"},
+		{"-json", "cli.option.json"},
+		{"-report <file>", "cli.option.report"},
+		{"-update-url <url>", "cli.option.update_url"},
+		{"-ssh <user@host[:port]>", "cli.option.ssh"},
+		{"-ssh-dir <path>", "cli.option.ssh_dir"},
+		{"-fetch-hostkey", "cli.option.fetch_hostkey"},
+		{"-v, -verbose", "cli.option.verbose"},
+		{"-h, --help", "cli.option.help"},
+		{"--version", "cli.option.version"},
+	}
+	for _, o := range options {
+		b.WriteString(fmt.Sprintf("  %-24s %s\n", o[0], t(o[1])))
+	}
+	return b.String()
+}
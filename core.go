@@ -10,24 +10,47 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
-	"time"
 )
 
 // ConfigType structure for update.config
 type ConfigType struct {
-	Version           int      `json:"version" default:"0"`
-	MainPHPFile       string   `json:"main_php_file"`
-	SkipPattern       []string `json:"skip_pattern"`
-	SSHHost           string   `json:"ssh_host"`
-	SSHPort           string   `json:"ssh_port"`
-	SSHDirBase        string   `json:"ssh_dir_base"`
-	SSHUser           string   `json:"ssh_user"`
-	SSHKeyFile        string   `json:"ssh_key_file"`
-	SSHKnownHosts     string   `json:"ssh_known_hosts"`
-	SSHPassword       string   `json:"ssh_password"`
-	SSHSecurePassword string   `json:"ssh_secure_password"`
+	Version           int                      `json:"version" default:"0"`
+	Type              string                   `json:"type" default:"plugin"`
+	MainPHPFile       string                   `json:"main_php_file"`
+	SkipPattern       []string                 `json:"skip_pattern"`
+	SSHHost           string                   `json:"ssh_host"`
+	SSHPort           string                   `json:"ssh_port"`
+	SSHDirBase        string                   `json:"ssh_dir_base"`
+	SSHUser           string                   `json:"ssh_user"`
+	SSHKeyFile        string                   `json:"ssh_key_file"`
+	SSHKnownHosts     string                   `json:"ssh_known_hosts"`
+	SSHPassword       string                   `json:"ssh_password"`
+	SSHSecurePassword string                   `json:"ssh_secure_password"`
+	Channels          map[string]ChannelConfig `json:"channels"`
+	MetadataSource    string                   `json:"metadata_source" default:"header"`
+	VersionLocations  []VersionLocation        `json:"version_locations"`
+	PUC               *bool                    `json:"puc"`
+	PUCFile           string                   `json:"puc_file"`
+	Timezone          string                   `json:"timezone" default:"UTC"`
+	TimestampFormat   string                   `json:"timestamp_format"`
+}
+
+// ChannelConfig describes a release channel (e.g. beta) with its own
+// update_info file in Updates and its own download directory on the server.
+type ChannelConfig struct {
+	UpdateInfoFile string `json:"update_info_file"`
+	DownloadPath   string `json:"download_path"`
+}
+
+// VersionLocation is a further place holding the plugin version, e.g. in
+// package.json. Type is json:<key.path>, const:<NAME>, define:<NAME> or
+// header; alternatively Pattern is a regex whose only group is the version.
+type VersionLocation struct {
+	File    string `json:"file"`
+	Type    string `json:"type,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
 }
 
 // UpdateInfo structure for update_info.json
@@ -95,6 +118,9 @@ func getUpdateInfo(updateInfoPath string) (*UpdateInfo, map[string]interface{},
 
 	var updateInfo UpdateInfo
 	if err := json.Unmarshal(data, &updateInfo); err != nil {
+		if issues := validateUpdateInfoData(data); len(issues) > 0 {
+			return nil, nil, updateInfoValidationError(updateInfoPath, issues)
+		}
 		return nil, nil, fmt.Errorf(t("error.update_info_structure"), err)
 	}
 
@@ -102,13 +128,13 @@ func getUpdateInfo(updateInfoPath string) (*UpdateInfo, map[string]interface{},
 	return &updateInfo, allData, nil
 }
 
-func processUpdateInfo(updateInfo *UpdateInfo, currentVersion string) error {
+func processUpdateInfo(updateInfo *UpdateInfo, currentVersion string, timestamp string) error {
 	logVerbose(t("log.processing_update_info"))
 
 	if getHigherVersion(updateInfo.Version, currentVersion) == currentVersion &&
 		updateInfo.Version != currentVersion {
 		updateInfo.Version = currentVersion
-		updateInfo.LastUpdated = time.Now().Format("2006-01-02 15:04:05")
+		updateInfo.LastUpdated = timestamp
 	}
 
 	return nil
@@ -124,23 +150,58 @@ func setUpdateInfo(updateInfo *UpdateInfo, allData map[string]interface{}, updat
 		return fmt.Errorf(t("error.json_mix"), err)
 	}
 
+	// Modelled fields replace the stored value, so a removed section or
+	// banner is removed from the file; only the non-string sub-keys a string
+	// map cannot hold survive. Unknown fields are merged, so sub-keys that
+	// UpdateInfo does not model survive. Unknown top level fields are taken
+	// from Extra when it is set, which lets the pipeline change or remove them.
+	fields := updateInfoFields()
+	stringMaps := stringMapFields()
 	for key, value := range structAsMap {
-		allData[key] = value
+		switch {
+		case stringMaps[key]:
+			allData[key] = keepSkippedSubKeys(allData[key], value)
+		case fields[key]:
+			allData[key] = value
+		default:
+			allData[key] = mergeJSONValues(allData[key], value)
+		}
+	}
+	// The notice only applies to the version that set it.
+	if updateInfo.Upgrade_notice == "" {
+		delete(allData, "upgrade_notice")
+	}
+	if updateInfo.Extra != nil {
+		for key := range allData {
+			if _, ok := updateInfo.Extra[key]; !ok && !fields[key] {
+				delete(allData, key)
+			}
+		}
 	}
 
 	updatedData, err := marshalWithoutHTMLescaping(allData)
 	if err != nil {
 		return fmt.Errorf(t("error.json_final"), err)
 	}
+	// Keep the key order and formatting of an existing file, so a release
+	// only changes the lines of the values that changed.
+	if original, err := readReleaseFile(updateInfoPath); err == nil {
+		if patched, ok := patchJSONDocument(original, allData); ok {
+			updatedData = patched
+		}
+	}
+	if issues := validateUpdateInfoData(updatedData); len(issues) > 0 {
+		return updateInfoValidationError(updateInfoPath, issues)
+	}
 
 	backupFilePath := updateInfoPath + ".bak"
-	if err := os.Rename(updateInfoPath, backupFilePath); err != nil {
+	if err := backupReleaseFile(updateInfoPath); err != nil {
 		return fmt.Errorf(t("error.backup_create"), err)
 	}
 	logVerbose(t("log.update_info_backup", backupFilePath))
 	logOpenedFile(updateInfoPath)
 
-	if err := os.WriteFile(updateInfoPath, updatedData, 0600); err != nil {
+	if err := writeReleaseFile(updateInfoPath, updatedData, 0600); err != nil {
 		return fmt.Errorf("%s", t("error.update_info_write_file", err))
 	}
 
@@ -148,23 +209,59 @@ func setUpdateInfo(updateInfo *UpdateInfo, allData map[string]interface{}, updat
 	return nil
 }
 
-func createZipFile(sourceDir, zipPath string, skipPatterns []string, slug string) error {
+// createZipFile packs the plugin into zipPath below the folder slug and
+// returns the names of the ZIP entries.
+func createZipFile(sourceDir, zipPath string, skipPatterns []string, slug string) ([]string, error) {
 	if err := validatePluginSlug(slug); err != nil {
-		return err
+		return nil, err
+	}
+
+	files, err := collectZipFiles(sourceDir, skipPatterns)
+	if err != nil {
+		return nil, fmt.Errorf(t("error.walk_files"), err)
+	}
+	entries := make([]string, len(files))
+	for i, relPath := range files {
+		entries[i] = slug + "/" + filepath.ToSlash(relPath)
+	}
+
+	if dryRun {
+		logAndPrint(t("dryrun.zip_create", zipPath, len(files)))
+		for _, entry := range entries {
+			logAndPrint("  " + entry)
+		}
+		return entries, nil
 	}
 
 	logVerbose(t("log.creating_zip", zipPath))
 	logOpenedFile(zipPath)
 
+	if err := recordReleaseFile(zipPath); err != nil {
+		return nil, fmt.Errorf(t("error.zip_create"), err)
+	}
 	zipFile, err := os.Create(zipPath) // # nosec G304
 	if err != nil {
-		return fmt.Errorf(t("error.zip_create"), err)
+		return nil, fmt.Errorf(t("error.zip_create"), err)
 	}
 	defer zipFile.Close()
 
 	zipWriter := zip.NewWriter(zipFile)
 	defer zipWriter.Close()
 
+	for i, relPath := range files {
+		if err := addFileToZip(zipWriter, filepath.Join(sourceDir, relPath), entries[i]); err != nil {
+			return nil, fmt.Errorf(t("error.walk_files"), err)
+		}
+		logVerbose(t("log.file_added", relPath))
+	}
+
+	logVerbose(t("log.zip_created"))
+	return entries, nil
+}
+
+// collectZipFiles returns the paths relative to sourceDir of all files that
+// belong into the release ZIP.
+func collectZipFiles(sourceDir string, skipPatterns []string) ([]string, error) {
 	defaultSkipPatterns := []string{
 		"Updates",
 		"update.config",
@@ -178,7 +275,8 @@ func createZipFile(sourceDir, zipPath string, skipPatterns []string, slug string
 	allSkipPatterns := append(defaultSkipPatterns, skipPatterns...)
 	logVerbose(t("log.skip_patterns", allSkipPatterns))
 
-	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+	var files []string
+	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -203,32 +301,27 @@ func createZipFile(sourceDir, zipPath string, skipPatterns []string, slug string
 		if info.IsDir() {
 			return nil
 		}
-
-		fileInZip, err := zipWriter.Create(slug + "/" + filepath.ToSlash(relPath))
-		if err != nil {
-			return err
-		}
-
-		logOpenedFile(path)
-		fileContent, err := os.Open(path) // # nosec G304
-		if err != nil {
-			return err
-		}
-		defer fileContent.Close()
-
-		if _, err := io.Copy(fileInZip, fileContent); err != nil {
-			return err
-		}
-
-		logVerbose(t("log.file_added", relPath))
+		files = append(files, relPath)
 		return nil
 	})
+	return files, err
+}
+
+func addFileToZip(zipWriter *zip.Writer, path string, nameInZip string) error {
+	fileInZip, err := zipWriter.Create(nameInZip)
 	if err != nil {
-		return fmt.Errorf(t("error.walk_files"), err)
+		return err
 	}
 
-	logVerbose(t("log.zip_created"))
-	return nil
+	logOpenedFile(path)
+	fileContent, err := os.Open(path) // # nosec G304
+	if err != nil {
+		return err
+	}
+	defer fileContent.Close()
+
+	_, err = io.Copy(fileInZip, fileContent)
+	return err
 }
 
 func shouldSkip(path string, patterns []string) bool {
@@ -249,7 +342,12 @@ func shouldSkip(path string, patterns []string) bool {
 	return false
 }
 
-func processMainPHPFile(workDir, mainPHPFile string, updateInfo *UpdateInfo) (string, error) {
+// processMainPHPFile synchronizes all versions in the main PHP file to the
+// highest one found, at least minVersion, or to the next version if bumpLevel
+// is set, and updates Last-Update. The other header fields are synchronized
+// with updateInfo as metadataSource decides. The PUC integration is updated
+// separately by syncPUCCall.
+func processMainPHPFile(workDir, mainPHPFile string, updateInfo *UpdateInfo, bumpLevel string, metadataSource string, minVersion string, timestamp string) (string, error) {
 	phpFilePath, err := safeJoinWithinBase(workDir, mainPHPFile)
 	if err != nil {
 		return "", err
@@ -257,136 +355,148 @@ func processMainPHPFile(workDir, mainPHPFile string, updateInfo *UpdateInfo) (st
 	logVerbose(t("log.processing_php", phpFilePath))
 	logOpenedFile(phpFilePath)
 
-	content, err := os.ReadFile(phpFilePath) // # nosec G304
+	content, err := readReleaseFile(phpFilePath)
 	if err != nil {
 		return "", fmt.Errorf("%s", t("error.php_read_file", err))
 	}
 
 	contentStr := string(content)
 
-	commentVersionRegex := regexp.MustCompile(`(?is)(?:/\*.*?\bVersion:\s*|//\s*Version:\s*)([0-9]+\.[0-9]+(?:\.[0-9]+)?)`)
-	commentMatch := commentVersionRegex.FindStringSubmatchIndex(contentStr)
+	versions := findPHPVersions(contentStr)
 
-	var commentVersion string
-	if len(commentMatch) == 4 {
-		commentVersion = contentStr[commentMatch[2]:commentMatch[3]]
-		logVerbose(t("log.version_comment_found", commentVersion))
+	currentVersion := getHigherVersion(versions.highest(), minVersion)
+	if currentVersion == "" {
+		return "", fmt.Errorf("%s", t("error.no_valid_version"))
 	}
-
-	classVersionRegex := regexp.MustCompile(`private\s+\$version\s*=\s*['"]+([0-9]+\.[0-9]+(?:\.[0-9]+)?)['"]+`)
-	classMatch := classVersionRegex.FindStringSubmatchIndex(contentStr)
-
-	var classVersion string
-	if len(classMatch) == 4 {
-		classVersion = contentStr[classMatch[2]:classMatch[3]]
-		logVerbose(t("log.version_class_found", classVersion))
+	if bumpLevel != "" {
+		nextVersion, err := bumpVersion(currentVersion, bumpLevel)
+		if err != nil {
+			return "", err
+		}
+		logAndPrint(t("log.version_bumped", currentVersion, nextVersion))
+		currentVersion = nextVersion
 	}
+	logVerbose(t("log.update_info_version_updated", currentVersion))
 
-	defineVersionRegex := regexp.MustCompile(`define\s*\(\s*['"]([A-Z_]+)_VERSION['"]\s*,\s*['"]([0-9]+\.[0-9]+(?:\.[0-9]+)?)['"]\s*\)`)
-	defineMatch := defineVersionRegex.FindStringSubmatchIndex(contentStr)
-
-	var defineVersion string
-	var defineKey string
-	if len(defineMatch) >= 6 {
-		defineKey = contentStr[defineMatch[2]:defineMatch[3]]
-		defineVersion = contentStr[defineMatch[4]:defineMatch[5]]
-		logVerbose(t("log.version_define_found", defineKey+"_VERSION", defineVersion))
+	// Replace from the end of the file so that a version of different length
+	// does not shift the positions of the remaining matches.
+	type replacement struct {
+		start, end int
+		logKey     string
 	}
-
-	currentVersion := getHigherVersion(commentVersion, classVersion)
-	currentVersion = getHigherVersion(currentVersion, defineVersion)
-	if currentVersion == "" {
-		return "", fmt.Errorf("%s", t("error.no_valid_version"))
+	var replacements []replacement
+	if versions.class != "" && versions.class != currentVersion {
+		replacements = append(replacements, replacement{versions.classPos[0], versions.classPos[1], "log.version_class_updated"})
+	}
+	if versions.comment != "" && versions.comment != currentVersion {
+		replacements = append(replacements, replacement{versions.commentPos[0], versions.commentPos[1], "log.version_comment_updated"})
+	}
+	if versions.define != "" && versions.define != currentVersion {
+		replacements = append(replacements, replacement{versions.definePos[0], versions.definePos[1], "log.version_define_updated"})
+	}
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start > replacements[j].start })
+	for _, r := range replacements {
+		contentStr = contentStr[:r.start] + currentVersion + contentStr[r.end:]
+		logVerbose(t(r.logKey, currentVersion))
 	}
-	logVerbose(t("log.update_info_version_updated", currentVersion))
 
-	if classVersion != "" && classVersion != currentVersion && len(classMatch) == 4 {
-		contentStr = contentStr[:classMatch[2]] + currentVersion + contentStr[classMatch[3]:]
-		logVerbose(t("log.version_class_updated", currentVersion))
+	contentStr, added, ok := setHeaderLastUpdate(contentStr, timestamp)
+	if ok && added {
+		logVerbose(t("log.last_update_added", timestamp))
+	} else if ok {
+		logVerbose(t("log.last_update_updated", timestamp))
 	}
 
-	if commentVersion != "" && commentVersion != currentVersion && len(commentMatch) == 4 {
-		contentStr = contentStr[:commentMatch[2]] + currentVersion + contentStr[commentMatch[3]:]
-		logVerbose(t("log.version_comment_updated", currentVersion))
+	contentStr, err = syncPluginHeader(contentStr, updateInfo, metadataSource)
+	if err != nil {
+		return "", err
 	}
 
-	if defineVersion != "" && defineVersion != currentVersion && len(defineMatch) >= 6 {
-		contentStr = contentStr[:defineMatch[4]] + currentVersion + contentStr[defineMatch[5]:]
-		logVerbose(t("log.version_define_updated", currentVersion))
+	if err := backupReleaseFile(phpFilePath); err != nil {
+		return "", fmt.Errorf(t("error.rename_file"), err)
+	}
+	if err := writeReleaseFile(phpFilePath, []byte(contentStr), 0600); err != nil {
+		return "", fmt.Errorf(t("error.write_php"), err)
 	}
 
-	currentDate := time.Now().Format("2006-01-02 15:04:05")
-	lastUpdateRegex := regexp.MustCompile(`(?is)(?:/\*.*?\bLast-Update:\s*|//\s*Last-Update:\s*)([0-9]{4}-[0-9]{2}-[0-9]{2}( [0-9]{2}:[0-9]{2}(:[0-9]{2})?)?)`)
-	lastUpdateMatch := lastUpdateRegex.FindStringSubmatchIndex(contentStr)
+	logVerbose(t("log.php_updated"))
+	return currentVersion, nil
+}
 
-	if len(lastUpdateMatch) >= 4 {
-		contentStr = contentStr[:lastUpdateMatch[2]] + currentDate + contentStr[lastUpdateMatch[3]:]
-		logVerbose(t("log.last_update_updated", currentDate))
-	} else {
-		commentVersionRegex = regexp.MustCompile(`(?is)(?:/\*.*?|//\s*)(\bVersion:\s*[0-9]+\.[0-9]+(?:\.[0-9]+)?)`)
-		commentMatch := commentVersionRegex.FindStringSubmatchIndex(contentStr)
-		if len(commentMatch) == 4 {
-			posBeforeVersion := commentMatch[2]
-			for posBeforeVersion > 0 && contentStr[posBeforeVersion] != '\n' {
-				posBeforeVersion--
-			}
-			contentStr = contentStr[:commentMatch[1]] +
-				contentStr[posBeforeVersion:commentMatch[2]] +
-				fmt.Sprintf("Last-Update: %s", currentDate) +
-				contentStr[commentMatch[1]:]
-			logVerbose(t("log.last_update_added", currentDate))
+// phpVersions holds the versions found in the main PHP file together with
+// their positions in the content.
+type phpVersions struct {
+	comment    string
+	class      string
+	define     string
+	defineKey  string
+	commentPos [2]int
+	classPos   [2]int
+	definePos  [2]int
+}
+
+// findPHPVersions reads the version of the header comment, the $version
+// property and the X_VERSION define from the tokens of the file, so versions
+// in other comments or in strings are ignored.
+func findPHPVersions(contentStr string) phpVersions {
+	var v phpVersions
+	tokens := lexSource(contentStr)
+
+	if tok, ok := findPHPHeader(tokens); ok {
+		start, end := headerCommentBody(tok)
+		if m := headerVersionRegex.FindStringSubmatchIndex(contentStr[start:end]); m != nil {
+			v.comment = contentStr[start+m[2] : start+m[3]]
+			v.commentPos = [2]int{start + m[2], start + m[3]}
+			logVerbose(t("log.version_comment_found", v.comment))
 		}
 	}
 
-	pucRegex := regexp.MustCompile(`(?s)\$?[a-zA-Z0-9_]*::buildUpdateChecker\(\s*'([^']*)'\s*,\s*__FILE__,\s*(//[^\n]*)?\s*'([-_a-zA-Z0-9]*)'\s*\)`)
-	pucMatch := pucRegex.FindStringSubmatchIndex(contentStr)
-	newDownloadURL := strings.Replace(updateInfo.DownloadURL, filepath.Base(updateInfo.DownloadURL), "update_info.json", 1)
-	if len(pucMatch) != 8 {
-		return "", fmt.Errorf("%s", t("error.no_valid_puc", phpFilePath))
+	if version, start, end, ok := findVersionProperty(tokens); ok {
+		v.class = version
+		v.classPos = [2]int{start, end}
+		logVerbose(t("log.version_class_found", v.class))
 	}
 
-	oldDownloadURL := ""
-	oldSlug := ""
-	if pucMatch[2] > 0 && (pucMatch[3] > pucMatch[2]) {
-		oldDownloadURL = contentStr[pucMatch[2]:pucMatch[3]]
-		logVerbose(t("log.puc_download_url", redactSensitiveURL(oldDownloadURL)))
-	} else {
-		return "", fmt.Errorf("%s", t("error.no_valid_puc", phpFilePath))
-	}
-	if pucMatch[4] > 0 && (pucMatch[5] > pucMatch[4]) {
-		logVerbose(t("log.puc_comment", contentStr[pucMatch[4]:pucMatch[5]]))
-	}
-	if pucMatch[6] > 0 && (pucMatch[7] > pucMatch[6]) {
-		oldSlug = contentStr[pucMatch[6]:pucMatch[7]]
-		logVerbose(t("log.puc_slug", oldSlug))
+	if key, version, start, end, ok := findVersionDefine(tokens); ok {
+		v.defineKey = key
+		v.define = version
+		v.definePos = [2]int{start, end}
+		logVerbose(t("log.version_define_found", v.defineKey+"_VERSION", v.define))
 	}
 
-	needUpdate := false
-	lengthdiff := 0
-	newSlug := updateInfo.Slug
-	if newSlug != oldSlug {
-		contentStr = contentStr[:pucMatch[6]] + newSlug + contentStr[pucMatch[7]:]
-		lengthdiff += len(newSlug) - len(oldSlug)
-		needUpdate = true
-	}
-	if newDownloadURL != oldDownloadURL {
-		contentStr = contentStr[:pucMatch[2]] + newDownloadURL + contentStr[pucMatch[3]:]
-		lengthdiff += len(newDownloadURL) - len(oldDownloadURL)
-		needUpdate = true
+	return v
+}
+
+func (v phpVersions) highest() string {
+	return getHigherVersion(getHigherVersion(v.comment, v.class), v.define)
+}
+
+// detectPluginVersion reads the version from the main PHP file without
+// changing it.
+func detectPluginVersion(workDir, mainPHPFile string) (string, error) {
+	versions, err := readPHPVersions(workDir, mainPHPFile)
+	if err != nil {
+		return "", err
 	}
-	if needUpdate {
-		logVerbose(t("log.puc_changed", contentStr[pucMatch[0]:(pucMatch[1]+lengthdiff)]))
+	version := versions.highest()
+	if version == "" {
+		return "", fmt.Errorf("%s", t("error.no_valid_version"))
 	}
+	return version, nil
+}
 
-	if err := os.Rename(phpFilePath, phpFilePath+".bak"); err != nil {
-		return "", fmt.Errorf(t("error.rename_file"), err)
+// readPHPVersions returns the versions found in the main PHP file.
+func readPHPVersions(workDir, mainPHPFile string) (phpVersions, error) {
+	phpFilePath, err := safeJoinWithinBase(workDir, mainPHPFile)
+	if err != nil {
+		return phpVersions{}, err
 	}
-	if err := os.WriteFile(phpFilePath, []byte(contentStr), 0600); err != nil {
-		return "", fmt.Errorf(t("error.write_php"), err)
+	logOpenedFile(phpFilePath)
+	content, err := readReleaseFile(phpFilePath)
+	if err != nil {
+		return phpVersions{}, fmt.Errorf("%s", t("error.php_read_file", err))
 	}
-
-	logVerbose(t("log.php_updated"))
-	return currentVersion, nil
+	return findPHPVersions(string(content)), nil
 }
 
 func getHigherVersion(v1, v2 string) string {
@@ -400,31 +510,9 @@ func getHigherVersion(v1, v2 string) string {
 		return v1
 	}
 
-	parts1 := strings.Split(v1, ".")
-	parts2 := strings.Split(v2, ".")
-
-	maxLen := len(parts1)
-	if len(parts2) > maxLen {
-		maxLen = len(parts2)
-	}
-
-	for i := 0; i < maxLen; i++ {
-		var n1, n2 int
-		if i < len(parts1) {
-			n1, _ = strconv.Atoi(parts1[i])
-		}
-		if i < len(parts2) {
-			n2, _ = strconv.Atoi(parts2[i])
-		}
-
-		if n1 > n2 {
-			return v1
-		}
-		if n2 > n1 {
-			return v2
-		}
+	if compareVersions(v2, v1) > 0 {
+		return v2
 	}
-
 	return v1
 }
 
@@ -478,4 +566,3 @@ func redactSensitiveURL(rawURL string) string {
 	parsedURL.Fragment = ""
 	return parsedURL.String()
 }
-
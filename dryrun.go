@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// dryRun is set by -dry-run. Every pipeline step still runs, but files are
+// only written to plannedFiles and uploads, conversions and git commands are
+// printed instead of executed.
+var dryRun bool
+
+var (
+	plannedFiles     = make(map[string][]byte)
+	plannedFilesLock sync.Mutex
+)
+
+// readReleaseFile reads a file, preferring content planned by an earlier
+// step of a dry run so later steps see what would have been written.
+func readReleaseFile(path string) ([]byte, error) {
+	plannedFilesLock.Lock()
+	data, ok := plannedFiles[path]
+	plannedFilesLock.Unlock()
+	if ok {
+		return data, nil
+	}
+	return os.ReadFile(path) // # nosec G304
+}
+
+// releaseFileExists reports whether a file exists on disk or was planned by
+// an earlier step of a dry run.
+func releaseFileExists(path string) bool {
+	plannedFilesLock.Lock()
+	_, ok := plannedFiles[path]
+	plannedFilesLock.Unlock()
+	if ok {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// writeReleaseFile writes a file that is part of the release. In dry-run mode
+// the content is kept in memory and the changed lines are printed instead.
+func writeReleaseFile(path string, data []byte, perm os.FileMode) error {
+	if !dryRun {
+		if err := recordReleaseFile(path); err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, perm)
+	}
+	old, _ := readReleaseFile(path)
+	plannedFilesLock.Lock()
+	plannedFiles[path] = data
+	plannedFilesLock.Unlock()
+	logAndPrint(t("dryrun.write_file", path))
+	printPlannedDiff(string(old), string(data))
+	return nil
+}
+
+// makeReleaseDir creates the directory path with its parents. The directory
+// is recorded in the journal, so a rollback removes it again. A dry run
+// creates nothing.
+func makeReleaseDir(path string, perm os.FileMode) error {
+	if dryRun {
+		return nil
+	}
+	if err := recordReleaseDir(path); err != nil {
+		return err
+	}
+	return os.MkdirAll(path, perm)
+}
+
+// backupReleaseFile renames a file to *.bak before it is rewritten. A file
+// that does not exist yet needs no backup.
+func backupReleaseFile(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if dryRun {
+		logVerbose(t("dryrun.backup_file", path+".bak"))
+		return nil
+	}
+	if err := recordReleaseFile(path); err != nil {
+		return err
+	}
+	if err := recordReleaseFile(path + ".bak"); err != nil {
+		return err
+	}
+	return os.Rename(path, path+".bak")
+}
+
+// printPlannedDiff prints the lines that differ between old and new content.
+// Common leading and trailing lines are skipped; the remaining block is
+// compared line by line with a longest common subsequence.
+func printPlannedDiff(oldContent, newContent string) {
+	oldLines := splitLines(oldContent)
+	newLines := splitLines(newContent)
+
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	a := oldLines[prefix : len(oldLines)-suffix]
+	b := newLines[prefix : len(newLines)-suffix]
+	if len(a) == 0 && len(b) == 0 {
+		logAndPrint(t("dryrun.no_changes"))
+		return
+	}
+
+	// Large blocks are not worth a quadratic diff, print them as replaced.
+	if len(a)*len(b) > 1000000 {
+		for i, l := range a {
+			logAndPrint(fmt.Sprintf("  %5d - %s", prefix+i+1, l))
+		}
+		for i, l := range b {
+			logAndPrint(fmt.Sprintf("  %5d + %s", prefix+i+1, l))
+		}
+		return
+	}
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			logAndPrint(fmt.Sprintf("  %5d - %s", prefix+i+1, a[i]))
+			i++
+		default:
+			logAndPrint(fmt.Sprintf("  %5d + %s", prefix+j+1, b[j]))
+			j++
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -28,7 +29,7 @@ func promptGitHubUpdate() bool {
 		return false
 	}
 
-	fmt.Print(t("prompt.github_update"))
+	fmt.Fprint(console, t("prompt.github_update"))
 	reader := bufio.NewReader(os.Stdin)
 	input, err := reader.ReadString('\n')
 	if err != nil {
@@ -40,21 +41,33 @@ func promptGitHubUpdate() bool {
 	return text == "y" || text == "yes" || text == "j" || text == "ja"
 }
 
-func handleGitHubIntegration(workDir string, updateInfo *UpdateInfo, zipPath string, commitMessageOverride string) error {
+// releaseCommittedError is a git error after the release commit was made. The
+// released files are part of the commit then and are not rolled back.
+type releaseCommittedError struct {
+	err error
+}
+
+func (e *releaseCommittedError) Error() string { return e.err.Error() }
+
+func (e *releaseCommittedError) Unwrap() error { return e.err }
+
+// handleGitHubIntegration commits, tags and pushes the release. It reports
+// whether the release was pushed, or would be in a dry run.
+func handleGitHubIntegration(workDir string, updateInfo *UpdateInfo, zipPath string, commitMessageOverride string) (bool, error) {
 	isGitHub, err := isGitHubRepository(workDir)
 	if err != nil {
-		return err
+		return false, err
 	}
 	if !isGitHub {
 		logVerbose(t("log.github_no_repo"))
-		return nil
+		return false, nil
 	}
 
 	logVerbose(t("log.github_repo_detected"))
 
-	if !promptGitHubUpdate() {
+	if !dryRun && !promptGitHubUpdate() {
 		logVerbose("GitHub update skipped by user")
-		return nil
+		return false, nil
 	}
 
 	changelogText := ""
@@ -68,20 +81,20 @@ func handleGitHubIntegration(workDir string, updateInfo *UpdateInfo, zipPath str
 
 	version := updateInfo.Version
 	if version == "" {
-		re := regexp.MustCompile(`v?([0-9]+\.[0-9]+(?:\.[0-9]+)?)`)
-		if matches := re.FindStringSubmatch(filepath.Base(zipPath)); len(matches) > 1 {
+		re := regexp.MustCompile(`v?(` + versionPattern + `)$`)
+		if matches := re.FindStringSubmatch(strings.TrimSuffix(filepath.Base(zipPath), ".zip")); len(matches) > 1 {
 			version = matches[1]
 		}
 	}
 	if version == "" {
 		logVerbose("Could not determine version for GitHub update")
-		return nil
+		return false, nil
 	}
 
 	tagExists, err := checkGitTagExists(workDir, version)
 	if err != nil {
 		logAndPrint(t("error.git_tag_check", err))
-		return err
+		return false, err
 	}
 	if tagExists {
 		logVerbose(t("log.git_tag_exists", version))
@@ -89,11 +102,21 @@ func handleGitHubIntegration(workDir string, updateInfo *UpdateInfo, zipPath str
 		logVerbose(t("log.git_tag_not_exists", version))
 	}
 
+	if dryRun {
+		logAndPrint(t("dryrun.git_commit", releaseCommitMessage(version, changelogText, commitMessageOverride)))
+		if tagExists {
+			logAndPrint(t("dryrun.git_tag_replace", "v"+version))
+		} else {
+			logAndPrint(t("dryrun.git_tag", "v"+version))
+		}
+		return true, nil
+	}
+
 	logVerbose(t("log.git_committing"))
 	err = gitCommitAndTag(workDir, version, changelogText, commitMessageOverride)
 	if err != nil {
 		logAndPrint(t("error.git_commit", err))
-		return err
+		return false, err
 	}
 
 	logVerbose(t("log.git_tagging", version))
@@ -101,11 +124,11 @@ func handleGitHubIntegration(workDir string, updateInfo *UpdateInfo, zipPath str
 	err = syncToRemote(workDir)
 	if err != nil {
 		logAndPrint(t("error.git_push", err))
-		return err
+		return false, &releaseCommittedError{err}
 	}
 
 	logVerbose(t("log.git_completed"))
-	return nil
+	return true, nil
 }
 
 func isGitHubRepository(workDir string) (bool, error) {
@@ -139,7 +162,7 @@ func checkGitTagExists(workDir string, version string) (bool, error) {
 	return strings.TrimSpace(string(output)) == tagName, nil
 }
 
-func gitCommitAndTag(workDir string, version string, changelogText string, commitMessageOverride string) error {
+func releaseCommitMessage(version string, changelogText string, commitMessageOverride string) string {
 	commitMessage := strings.TrimSpace(commitMessageOverride)
 	if commitMessage == "" {
 		commitMessage = changelogText
@@ -147,13 +170,20 @@ func gitCommitAndTag(workDir string, version string, changelogText string, commi
 	if commitMessage == "" {
 		commitMessage = fmt.Sprintf("Release version %s", version)
 	}
+	return commitMessage
+}
 
+func gitCommitAndTag(workDir string, version string, changelogText string, commitMessageOverride string) error {
+	commitMessage := releaseCommitMessage(version, changelogText, commitMessageOverride)
+
+	stagedBefore := stagedGitPaths(workDir)
 	if err := runGitCommand(workDir, "add", "-A"); err != nil {
 		return fmt.Errorf(t("error.git_commit"), err)
 	}
 
 	if err := runGitCommand(workDir, "commit", "-m", commitMessage); err != nil {
 		if err2 := runGitCommand(workDir, "diff", "--cached", "--quiet"); err2 != nil {
+			unstageReleasePaths(workDir, stagedBefore)
 			return fmt.Errorf(t("error.git_commit"), err)
 		}
 	}
@@ -161,19 +191,19 @@ func gitCommitAndTag(workDir string, version string, changelogText string, commi
 	logVerbose(t("log.git_syncing"))
 	if err := runGitCommand(workDir, "pull", "--rebase"); err != nil {
 		if err2 := runGitCommand(workDir, "pull"); err2 != nil {
-			return fmt.Errorf(t("error.git_sync"), err2)
+			return &releaseCommittedError{fmt.Errorf(t("error.git_sync"), err2)}
 		}
 	}
 
 	if err := runGitCommand(workDir, "push"); err != nil {
-		return fmt.Errorf(t("error.git_push"), err)
+		return &releaseCommittedError{fmt.Errorf(t("error.git_push"), err)}
 	}
 
 	tagName := fmt.Sprintf("v%s", version)
 
 	tagExists, err := checkGitTagExists(workDir, version)
 	if err != nil {
-		return err
+		return &releaseCommittedError{err}
 	}
 
 	if tagExists {
@@ -181,7 +211,7 @@ func gitCommitAndTag(workDir string, version string, changelogText string, commi
 	}
 
 	if err := runGitCommand(workDir, "tag", "-a", tagName, "-m", commitMessage); err != nil {
-		return fmt.Errorf(t("error.git_tag"), err)
+		return &releaseCommittedError{fmt.Errorf(t("error.git_tag"), err)}
 	}
 
 	if tagExists {
@@ -189,12 +219,48 @@ func gitCommitAndTag(workDir string, version string, changelogText string, commi
 	}
 
 	if err := runGitCommand(workDir, "push", "origin", tagName); err != nil {
-		return fmt.Errorf(t("error.git_tag"), err)
+		return &releaseCommittedError{fmt.Errorf(t("error.git_tag"), err)}
 	}
 
 	return nil
 }
 
+// stagedGitPaths returns the paths in the git index of workDir that differ
+// from HEAD.
+func stagedGitPaths(workDir string) map[string]bool {
+	paths := map[string]bool{}
+	output, err := runGitCommandOutput(workDir, "diff", "--cached", "--name-only", "-z")
+	if err != nil {
+		return paths
+	}
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path != "" {
+			paths[path] = true
+		}
+	}
+	return paths
+}
+
+// unstageReleasePaths takes the paths the release staged out of the index
+// again after the commit failed. Paths staged before the release stay staged.
+func unstageReleasePaths(workDir string, stagedBefore map[string]bool) {
+	var paths []string
+	for path := range stagedGitPaths(workDir) {
+		if !stagedBefore[path] {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	sort.Strings(paths)
+	if err := runGitCommand(workDir, append([]string{"reset", "--quiet", "--"}, paths...)...); err != nil {
+		logAndPrint(t("error.git_unstage", err))
+		return
+	}
+	logVerbose(t("log.git_unstaged", len(paths)))
+}
+
 func syncToRemote(workDir string) error {
 	if err := runGitCommand(workDir, "push"); err != nil {
 		return fmt.Errorf(t("error.git_push"), err)
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// pluginHeaderRegex matches a field of the WordPress plugin header comment.
+var pluginHeaderRegex = regexp.MustCompile(`(?m)^[ \t/*#@]*([A-Za-z][A-Za-z ]*[A-Za-z]):[ \t]*(.*?)[ \t]*(?:\*/.*)?\r?$`)
+
+// headerUpdateInfoFields maps plugin header fields to the update_info.json
+// fields they are synchronized with.
+var headerUpdateInfoFields = []struct {
+	header string
+	field  func(*UpdateInfo) *string
+}{
+	{"Plugin Name", func(u *UpdateInfo) *string { return &u.Name }},
+	{"Plugin URI", func(u *UpdateInfo) *string { return &u.Homepage }},
+	{"Author", func(u *UpdateInfo) *string { return &u.Author }},
+	{"Author URI", func(u *UpdateInfo) *string { return &u.AuthorProfile }},
+	{"Requires at least", func(u *UpdateInfo) *string { return &u.RequiresWP }},
+	{"Requires PHP", func(u *UpdateInfo) *string { return &u.RequiresPHP }},
+	{"Tested up to", func(u *UpdateInfo) *string { return &u.TestedWP }},
+}
+
+// pluginHeaderRange returns the part of content that holds the plugin header:
+// the comment with "Plugin Name:" within the first 8 KB, like WordPress, or
+// the comment with "Theme Name:" of a theme's style.css.
+func pluginHeaderRange(content string) (int, int, bool) {
+	tokens := lexSource(content)
+	for _, marker := range headerMarkers {
+		if tok, ok := findHeaderComment(tokens, marker); ok {
+			start, end := headerCommentBody(tok)
+			return start, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// parsePluginHeader returns the fields of the plugin header, or nil if there
+// is no "Plugin Name:" or "Theme Name:".
+func parsePluginHeader(content string) map[string]string {
+	start, end, ok := pluginHeaderRange(content)
+	if !ok {
+		return nil
+	}
+	fields := make(map[string]string)
+	for _, m := range pluginHeaderRegex.FindAllStringSubmatch(content[start:end], -1) {
+		if _, ok := fields[m[1]]; !ok && m[2] != "" {
+			fields[m[1]] = m[2]
+		}
+	}
+	if fields["Plugin Name"] == "" && fields["Theme Name"] == "" {
+		return nil
+	}
+	return fields
+}
+
+// readPluginHeader returns the plugin header fields of a PHP file.
+func readPluginHeader(path string) (map[string]string, error) {
+	f, err := os.Open(path) // # nosec G304
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, 8192)
+	n, _ := f.Read(buf)
+	return parsePluginHeader(string(buf[:n])), nil
+}
+
+// setPluginHeaderField sets a field of the plugin header. A missing field is
+// added after the last field, with the same comment prefix.
+func setPluginHeaderField(content string, key string, value string) string {
+	start, end, ok := pluginHeaderRange(content)
+	if !ok {
+		return content
+	}
+	header := content[start:end]
+	fieldRegex := regexp.MustCompile(`(?mi)^([ \t/*#@]*` + regexp.QuoteMeta(key) + `:[ \t]*)(.*?)([ \t]*\r?)$`)
+	if m := fieldRegex.FindStringSubmatchIndex(header); m != nil {
+		return content[:start+m[4]] + value + content[start+m[5]:]
+	}
+
+	var last []int
+	for _, m := range pluginHeaderRegex.FindAllStringSubmatchIndex(header, -1) {
+		last = m
+	}
+	if last == nil {
+		return content
+	}
+	lineEnd := start + last[1]
+	prefix := header[last[0]:last[2]]
+	return content[:lineEnd] + "\n" + prefix + key + ": " + value + content[lineEnd:]
+}
+
+// syncPluginHeader synchronizes name, URIs, author and requirements between
+// the plugin or theme header and update_info.json. source decides which side wins:
+// "header" (default) copies the header into updateInfo, "update_info" writes
+// updateInfo into the header, "none" leaves both alone. Empty values never
+// overwrite.
+func syncPluginHeader(content string, updateInfo *UpdateInfo, source string) (string, error) {
+	switch source {
+	case "none":
+		return content, nil
+	case "", "header", "update_info":
+	default:
+		return content, fmt.Errorf("%s", t("error.metadata_source", source))
+	}
+	header := parsePluginHeader(content)
+	if header == nil {
+		return content, nil
+	}
+	isTheme := header["Plugin Name"] == ""
+	for _, f := range headerUpdateInfoFields {
+		key := f.header
+		if isTheme {
+			// The header of a theme's style.css has Theme Name and Theme URI.
+			key = strings.Replace(key, "Plugin ", "Theme ", 1)
+		}
+		field := f.field(updateInfo)
+		headerValue := header[key]
+		if source == "update_info" {
+			if *field != "" && *field != headerValue {
+				content = setPluginHeaderField(content, key, *field)
+				logVerbose(t("log.header_field_updated", key, *field))
+			}
+		} else if headerValue != "" && headerValue != *field {
+			*field = headerValue
+			logVerbose(t("log.update_info_field_updated", key, headerValue))
+		}
+	}
+	return content, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// releaseHistoryEntry is one release in Updates/releases.json. Like the JSON
+// report its field names are kept stable for scripts.
+type releaseHistoryEntry struct {
+	Version     string `json:"version"`
+	Date        string `json:"date"`
+	Channel     string `json:"channel,omitempty"`
+	Zip         string `json:"zip"`
+	Size        int64  `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	DownloadURL string `json:"download_url"`
+	Commit      string `json:"commit,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	Changelog   string `json:"changelog,omitempty"`
+	ReleasedBy  string `json:"released_by,omitempty"`
+}
+
+// releaseHistoryPath returns the path of the release history of workDir.
+func releaseHistoryPath(workDir string) string {
+	return filepath.Join(workDir, "Updates", "releases.json")
+}
+
+// readReleaseHistory returns the entries of Updates/releases.json, oldest
+// first. A missing file has no entries.
+func readReleaseHistory(workDir string) ([]releaseHistoryEntry, error) {
+	path := releaseHistoryPath(workDir)
+	if !releaseFileExists(path) {
+		return nil, nil
+	}
+	logOpenedFile(path)
+	data, err := readReleaseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []releaseHistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s", t("error.release_history_invalid", path, err))
+	}
+	return entries, nil
+}
+
+// appendReleaseHistory adds entry at the end of Updates/releases.json.
+func appendReleaseHistory(workDir string, entry releaseHistoryEntry) error {
+	entries, err := readReleaseHistory(workDir)
+	if err != nil {
+		return err
+	}
+	data, err := marshalWithoutHTMLescaping(append(entries, entry))
+	if err != nil {
+		return err
+	}
+	return writeReleaseFile(releaseHistoryPath(workDir), data, 0644)
+}
+
+// releasedBy names the person releasing: the git user of workDir, or the
+// user of the operating system.
+func releasedBy(workDir string) string {
+	name, _ := runGitCommandOutput(workDir, "config", "user.name")
+	email, _ := runGitCommandOutput(workDir, "config", "user.email")
+	who := strings.TrimSpace(string(name))
+	if mail := strings.TrimSpace(string(email)); mail != "" {
+		who = strings.TrimSpace(who + " <" + mail + ">")
+	}
+	if who != "" {
+		return who
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if who = os.Getenv("USER"); who == "" {
+		who = os.Getenv("USERNAME")
+	}
+	return who
+}
+
+// recordRelease appends the finished release to Updates/releases.json with
+// the release commit and tag if the git stage ran; both stay empty if it was
+// skipped. After a pushed release the entry is committed and pushed on its
+// own, as the release commit cannot name itself. Errors are only logged.
+func (ctx *releaseContext) recordRelease() {
+	entry := releaseHistoryEntry{
+		Version:     ctx.currentVersion,
+		Date:        ctx.timestamp,
+		Channel:     ctx.opts.channel,
+		Zip:         ctx.zipFileName,
+		DownloadURL: ctx.updateInfo.DownloadURL,
+		Commit:      ctx.gitCommit,
+		Tag:         ctx.gitTag,
+		Changelog:   ctx.changelogText,
+		ReleasedBy:  releasedBy(ctx.workDir),
+	}
+	if entry.Changelog == "" {
+		entry.Changelog, _ = readChangelog(ctx.workDir, ctx.currentVersion)
+	}
+	entry.Changelog = stripUpgradeNotice(entry.Changelog)
+	if !dryRun {
+		if size, sum, err := fileSHA256(ctx.zipPath); err == nil {
+			entry.Size, entry.SHA256 = size, sum
+		}
+	}
+	if err := appendReleaseHistory(ctx.workDir, entry); err != nil {
+		logAndPrint(t("error.release_history", err))
+		return
+	}
+	logVerbose(t("log.release_history_added", ctx.currentVersion, filepath.Base(releaseHistoryPath(ctx.workDir))))
+
+	if ctx.gitStatus != stageDone {
+		return
+	}
+	if err := commitReleaseHistory(ctx.workDir, ctx.currentVersion); err != nil {
+		logAndPrint(t("error.release_history_commit", err))
+	}
+}
+
+// commitReleaseHistory commits and pushes Updates/releases.json alone.
+func commitReleaseHistory(workDir string, version string) error {
+	rel, err := filepath.Rel(workDir, releaseHistoryPath(workDir))
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	if err := runGitCommand(workDir, "add", "--", rel); err != nil {
+		return err
+	}
+	if err := runGitCommand(workDir, "commit", "-m", fmt.Sprintf("Record release %s", version), "--", rel); err != nil {
+		return err
+	}
+	return runGitCommand(workDir, "push")
+}
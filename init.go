@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// initConfig is the update.config written by the init command. The field
+// order is the one of the README example.
+type initConfig struct {
+	MainPHPFile string   `json:"main_php_file"`
+	SkipPattern []string `json:"skip_pattern"`
+	SSHHost     string   `json:"ssh_host,omitempty"`
+	SSHPort     string   `json:"ssh_port,omitempty"`
+	SSHDirBase  string   `json:"ssh_dir_base,omitempty"`
+	SSHUser     string   `json:"ssh_user,omitempty"`
+	SSHKeyFile  string   `json:"ssh_key_file,omitempty"`
+}
+
+// findMainPHPFile returns the PHP file in workDir with a "Plugin Name:"
+// header. With several candidates the one named like the directory wins.
+func findMainPHPFile(workDir string) (string, []string, error) {
+	matches, err := filepath.Glob(filepath.Join(workDir, "*.php"))
+	if err != nil {
+		return "", nil, err
+	}
+	sort.Strings(matches)
+	var candidates []string
+	for _, path := range matches {
+		if fields, err := readPluginHeader(path); err == nil && fields != nil {
+			candidates = append(candidates, filepath.Base(path))
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", nil, fmt.Errorf("%s", t("error.init_no_main_file", workDir))
+	case 1:
+		return candidates[0], candidates, nil
+	}
+	named := filepath.Base(workDir) + ".php"
+	for _, c := range candidates {
+		if c == named {
+			return c, candidates, nil
+		}
+	}
+	return "", candidates, nil
+}
+
+// parseSSHTarget splits "user@host[:port]".
+func parseSSHTarget(target string) (user, host, port string, err error) {
+	at := strings.Index(target, "@")
+	if at <= 0 || at == len(target)-1 {
+		return "", "", "", fmt.Errorf("%s", t("error.init_ssh_target", target))
+	}
+	user, host = target[:at], target[at+1:]
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host, port = host[:i], host[i+1:]
+		if _, err := strconv.Atoi(port); err != nil || host == "" {
+			return "", "", "", fmt.Errorf("%s", t("error.init_ssh_target", target))
+		}
+	}
+	return user, host, port, nil
+}
+
+// pucSnippet returns the plugin-update-checker bootstrap in the form the
+// release process recognizes.
+func pucSnippet(updateInfoURL, slug string) string {
+	return "\n" +
+		"require_once __DIR__ . '/plugin-update-checker/plugin-update-checker.php';\n" +
+		"$updateChecker = \\YahnisElsts\\PluginUpdateChecker\\v5\\PucFactory::buildUpdateChecker(\n" +
+		"\t'" + updateInfoURL + "',\n" +
+		"\t__FILE__,\n" +
+		"\t'" + slug + "'\n" +
+		");\n"
+}
+
+// insertPUCSnippet adds the snippet after the plugin header comment, or after
+// an ABSPATH guard that directly follows it.
+func insertPUCSnippet(content, snippet string) (string, bool) {
+	header, ok := findHeaderComment(lexPHP(content), "Plugin Name:")
+	if !ok || !strings.HasSuffix(header.text, "*/") {
+		return content, false
+	}
+	pos := nextLine(content, header.end)
+	rest := strings.TrimLeft(content[pos:], " \t\r\n")
+	if firstLine, _, _ := strings.Cut(rest, "\n"); strings.Contains(firstLine, "ABSPATH") {
+		pos = nextLine(content, len(content)-len(rest))
+	}
+	if pos == len(content) && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+		pos++
+	}
+	return content[:pos] + snippet + content[pos:], true
+}
+
+func nextLine(content string, pos int) int {
+	if nl := strings.Index(content[pos:], "\n"); nl >= 0 {
+		return pos + nl + 1
+	}
+	return len(content)
+}
+
+// promptInit asks for a value on the terminal. The default is taken on an
+// empty answer.
+func promptInit(key string, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Fprint(console, t(key)+" ["+defaultValue+"]: ")
+	} else {
+		fmt.Fprint(console, t(key)+": ")
+	}
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if text := strings.TrimSpace(input); text != "" {
+		return text, nil
+	}
+	return defaultValue, nil
+}
+
+// runInit prepares the plugin in workDir for releasing: it writes
+// Updates/update_info.json, adds the PUC bootstrap to the main PHP file and
+// writes update.config last. Values not given as options are asked for on a
+// terminal. If init fails, the files it changed are restored, so it can be
+// run again.
+func runInit(workDir string, opts *cliOptions) error {
+	journal := startJournal(workDir)
+	defer journal.close()
+
+	err := initPlugin(workDir, opts)
+	if err != nil && !dryRun {
+		logAndPrint(t("log.init_rollback"))
+		if err := journal.restore(); err != nil {
+			logAndPrint(t("error.rollback_local", err))
+		}
+	}
+	return err
+}
+
+func initPlugin(workDir string, opts *cliOptions) error {
+	configPath := filepath.Join(workDir, "update.config")
+	if releaseFileExists(configPath) {
+		return fmt.Errorf("%s", t("error.init_exists", configPath))
+	}
+	interactive := isInteractiveTerminal()
+
+	mainFile, candidates, err := findMainPHPFile(workDir)
+	if err != nil {
+		return err
+	}
+	if mainFile == "" {
+		if !interactive {
+			return fmt.Errorf("%s", t("error.init_main_file_ambiguous", strings.Join(candidates, ", ")))
+		}
+		logAndPrint(t("log.init_main_file_candidates", strings.Join(candidates, ", ")))
+		if mainFile, err = promptInit("prompt.init_main_file", candidates[0]); err != nil {
+			return err
+		}
+	}
+	mainPath, err := safeJoinWithinBase(workDir, mainFile)
+	if err != nil {
+		return err
+	}
+	header, err := readPluginHeader(mainPath)
+	if err != nil || header == nil {
+		return fmt.Errorf("%s", t("error.init_no_main_file", workDir))
+	}
+	logAndPrint(t("log.init_main_file", mainFile, header["Plugin Name"]))
+
+	version, err := detectPluginVersion(workDir, mainFile)
+	if err != nil {
+		return err
+	}
+	// WordPress names the plugin after its directory, fall back to the file.
+	slug := workDir
+	if abs, err := filepath.Abs(workDir); err == nil {
+		slug = abs
+	}
+	slug = filepath.Base(slug)
+	if validatePluginSlug(slug) != nil {
+		slug = strings.TrimSuffix(mainFile, ".php")
+		if err := validatePluginSlug(slug); err != nil {
+			return err
+		}
+	}
+
+	updateURL := opts.initUpdateURL
+	if updateURL == "" && interactive {
+		if updateURL, err = promptInit("prompt.init_update_url", ""); err != nil {
+			return err
+		}
+	}
+	if updateURL == "" {
+		return fmt.Errorf("%s", t("error.init_update_url_required"))
+	}
+	if u, err := url.Parse(updateURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s", t("error.init_update_url", updateURL))
+	}
+	updateURL = strings.TrimSuffix(updateURL, "/") + "/"
+
+	cfg := initConfig{MainPHPFile: mainFile, SkipPattern: []string{}}
+	sshTarget := opts.initSSH
+	if sshTarget == "" && interactive {
+		if sshTarget, err = promptInit("prompt.init_ssh_target", ""); err != nil {
+			return err
+		}
+	}
+	if sshTarget != "" {
+		if cfg.SSHUser, cfg.SSHHost, cfg.SSHPort, err = parseSSHTarget(sshTarget); err != nil {
+			return err
+		}
+		cfg.SSHDirBase = opts.initSSHDir
+		if cfg.SSHDirBase == "" && interactive {
+			if cfg.SSHDirBase, err = promptInit("prompt.init_ssh_dir", "/var/www/html"); err != nil {
+				return err
+			}
+		}
+		if cfg.SSHDirBase == "" {
+			return fmt.Errorf("%s", t("error.init_ssh_dir_required"))
+		}
+		home, _ := os.UserHomeDir()
+		for _, key := range []string{"id_ed25519", "id_rsa"} {
+			if keyPath := filepath.Join(home, ".ssh", key); home != "" && fileExists(keyPath) {
+				cfg.SSHKeyFile = keyPath
+				break
+			}
+		}
+	}
+
+	updatesDir := filepath.Join(workDir, "Updates")
+	updateInfoPath := filepath.Join(updatesDir, "update_info.json")
+	if releaseFileExists(updateInfoPath) {
+		logAndPrint(t("log.init_kept", updateInfoPath))
+	} else {
+		if err := makeReleaseDir(updatesDir, 0755); err != nil {
+			return err
+		}
+		updateInfo := &UpdateInfo{
+			Version:       version,
+			DownloadURL:   fmt.Sprintf("%s%s-v%s.zip", updateURL, slug, version),
+			Slug:          slug,
+			Name:          header["Plugin Name"],
+			Homepage:      header["Plugin URI"],
+			Author:        header["Author"],
+			AuthorProfile: header["Author URI"],
+			RequiresWP:    header["Requires at least"],
+			RequiresPHP:   header["Requires PHP"],
+		}
+		if err := setUpdateInfo(updateInfo, map[string]interface{}{}, updateInfoPath); err != nil {
+			return err
+		}
+		logAndPrint(t("log.init_written", updateInfoPath))
+	}
+
+	content, err := readReleaseFile(mainPath)
+	if err != nil {
+		return fmt.Errorf("%s", t("error.php_read_file", err))
+	}
+	if _, ok := findPUCCall(string(content)); ok {
+		logAndPrint(t("log.init_puc_present", mainFile))
+	} else {
+		newContent, ok := insertPUCSnippet(string(content), pucSnippet(updateURL+"update_info.json", slug))
+		if !ok {
+			return fmt.Errorf("%s", t("error.init_puc_insert", mainFile))
+		}
+		if err := writeReleaseFile(mainPath, []byte(newContent), 0600); err != nil {
+			return err
+		}
+		logAndPrint(t("log.init_puc_added", mainFile))
+		if !fileExists(filepath.Join(workDir, "plugin-update-checker", "plugin-update-checker.php")) {
+			logAndPrint(t("log.init_puc_library"))
+		}
+	}
+
+	configData, err := marshalWithoutHTMLescaping(cfg)
+	if err != nil {
+		return err
+	}
+	if err := writeReleaseFile(configPath, configData, 0600); err != nil {
+		return err
+	}
+	logAndPrint(t("log.init_written", configPath))
+
+	if cfg.SSHHost != "" && cfg.SSHKeyFile == "" {
+		logAndPrint(t("log.init_ssh_auth"))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// releaseJournal remembers the original state of every local file a command
+// changes, so a failed release can be rolled back.
+type releaseJournal struct {
+	workDir string
+	lock    sync.Mutex
+	entries map[string]*journalEntry
+	order   []string
+}
+
+type journalEntry struct {
+	existed bool
+	dir     bool
+	data    []byte
+	mode    os.FileMode
+}
+
+// Journals of the running commands by plugin directory. Plugins of a
+// workspace released in parallel each have their own journal.
+var (
+	journals     = make(map[string]*releaseJournal)
+	journalsLock sync.Mutex
+)
+
+// journalPath returns path as an absolute path, so relative and absolute
+// paths of the same file match.
+func journalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// startJournal starts recording changes to files below workDir.
+func startJournal(workDir string) *releaseJournal {
+	j := &releaseJournal{workDir: journalPath(workDir), entries: make(map[string]*journalEntry)}
+	journalsLock.Lock()
+	journals[j.workDir] = j
+	journalsLock.Unlock()
+	return j
+}
+
+// close stops recording. The recorded state is still available to restore.
+func (j *releaseJournal) close() {
+	journalsLock.Lock()
+	if journals[j.workDir] == j {
+		delete(journals, j.workDir)
+	}
+	journalsLock.Unlock()
+}
+
+// journalFor returns the journal of the plugin the absolute path belongs to,
+// or nil if no command of that plugin is running.
+func journalFor(path string) *releaseJournal {
+	journalsLock.Lock()
+	defer journalsLock.Unlock()
+	for dir, candidate := range journals {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// recordReleaseFile saves the current state of path in the journal of the
+// plugin it belongs to before it is changed. Only the first change counts.
+func recordReleaseFile(path string) error {
+	path = journalPath(path)
+	j := journalFor(path)
+	if j == nil {
+		return nil
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if _, ok := j.entries[path]; ok {
+		return nil
+	}
+	entry := &journalEntry{}
+	if info, err := os.Stat(path); err == nil {
+		data, err := os.ReadFile(path) // # nosec G304
+		if err != nil {
+			return err
+		}
+		entry.existed = true
+		entry.data = data
+		entry.mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	j.entries[path] = entry
+	j.order = append(j.order, path)
+	return nil
+}
+
+// recordReleaseDir notes in the journal that the directory path is about to
+// be created, so a rollback removes it again. An existing directory is left
+// out, it is never removed.
+func recordReleaseDir(path string) error {
+	path = journalPath(path)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	j := journalFor(path)
+	if j == nil {
+		return nil
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if _, ok := j.entries[path]; ok {
+		return nil
+	}
+	j.entries[path] = &journalEntry{dir: true}
+	j.order = append(j.order, path)
+	return nil
+}
+
+// empty reports whether no file was changed.
+func (j *releaseJournal) empty() bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return len(j.order) == 0
+}
+
+// recorded reports whether path was changed and whether it existed before.
+func (j *releaseJournal) recorded(path string) (changed bool, existed bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	entry, ok := j.entries[journalPath(path)]
+	if !ok {
+		return false, false
+	}
+	return true, entry.existed
+}
+
+// restore puts all recorded files back into their original state, newest
+// change first. Files and directories that did not exist are removed.
+func (j *releaseJournal) restore() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	var firstErr error
+	for i := len(j.order) - 1; i >= 0; i-- {
+		path := j.order[i]
+		entry := j.entries[path]
+		var err error
+		if entry.existed {
+			err = os.WriteFile(path, entry.data, entry.mode)
+		} else if err = os.Remove(path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		logVerbose(t("log.rollback_file", path))
+	}
+	return firstErr
+}
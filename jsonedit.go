@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// jsonMember is a member of a JSON object in the source text: the position
+// of its key and of its value.
+type jsonMember struct {
+	key                  string
+	start                int
+	valueStart, valueEnd int
+}
+
+// jsonEdit replaces src[start:end] with text.
+type jsonEdit struct {
+	start, end int
+	text       string
+}
+
+// patchJSONDocument writes the values of updated into the JSON object src
+// and returns the new text. Only changed values are replaced, so the key
+// order, indentation and unknown fields of the file stay as they are. New
+// keys are appended to their object, keys missing in updated are removed.
+func patchJSONDocument(src []byte, updated map[string]interface{}) ([]byte, bool) {
+	text := string(src)
+	open := skipJSONSpace(text, 0)
+	if open >= len(text) || text[open] != '{' {
+		return nil, false
+	}
+	var normalized interface{}
+	raw, err := json.Marshal(updated)
+	if err != nil || json.Unmarshal(raw, &normalized) != nil {
+		return nil, false
+	}
+	object, isObject := normalized.(map[string]interface{})
+	if !isObject {
+		return nil, false
+	}
+	edits, ok := patchJSONObject(text, open, object, jsonIndentUnit(text))
+	if !ok {
+		return nil, false
+	}
+	// Apply from the end; at the same position a removal goes before an
+	// insertion, so the inserted text is not removed with it.
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start > edits[j].start
+		}
+		return edits[i].end > edits[j].end
+	})
+	for _, e := range edits {
+		text = text[:e.start] + e.text + text[e.end:]
+	}
+	return []byte(text), true
+}
+
+// patchJSONObject returns the edits that turn the object starting at
+// src[open] into updated.
+func patchJSONObject(src string, open int, updated map[string]interface{}, unit string) ([]jsonEdit, bool) {
+	members, end, ok := scanJSONObject(src, open)
+	if !ok {
+		return nil, false
+	}
+
+	var edits []jsonEdit
+	var kept []jsonMember
+	for i, m := range members {
+		value, stays := updated[m.key]
+		if !stays {
+			if i > 0 {
+				edits = append(edits, jsonEdit{members[i-1].valueEnd, m.valueEnd, ""})
+			}
+			continue
+		}
+		kept = append(kept, m)
+		var current interface{}
+		if json.Unmarshal([]byte(src[m.valueStart:m.valueEnd]), &current) != nil {
+			return nil, false
+		}
+		if reflect.DeepEqual(current, value) {
+			continue
+		}
+		newObject, isObject := value.(map[string]interface{})
+		if _, wasObject := current.(map[string]interface{}); isObject && wasObject {
+			nested, ok := patchJSONObject(src, m.valueStart, newObject, unit)
+			if !ok {
+				return nil, false
+			}
+			edits = append(edits, nested...)
+			continue
+		}
+		edits = append(edits, jsonEdit{m.valueStart, m.valueEnd, encodeJSONValue(value, lineIndent(src, m.start), unit, isMultiline(src, open, end))})
+	}
+
+	if len(kept) == 0 {
+		// Nothing to keep the formatting of, write the object anew.
+		return []jsonEdit{{open, end, encodeJSONValue(updated, lineIndent(src, open), unit, isMultiline(src, open, end))}}, true
+	}
+	if first := kept[0]; first.start != members[0].start {
+		// Leading members were removed: drop them up to the first kept key,
+		// which takes over their place and separator.
+		edits = dropEditsWithin(edits, members[0].start, first.start)
+		edits = append(edits, jsonEdit{members[0].start, first.start, ""})
+	}
+
+	var added []string
+	for key := range updated {
+		if !hasJSONMember(members, key) {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+	if len(added) > 0 {
+		last := kept[len(kept)-1]
+		indent := lineIndent(src, last.start)
+		separator := ", "
+		if isMultiline(src, open, end) {
+			separator = ",\n" + indent
+		}
+		var b strings.Builder
+		for _, key := range added {
+			b.WriteString(separator)
+			b.WriteString(encodeJSONValue(key, indent, unit, false))
+			b.WriteString(": ")
+			b.WriteString(encodeJSONValue(updated[key], indent, unit, isMultiline(src, open, end)))
+		}
+		edits = append(edits, jsonEdit{last.valueEnd, last.valueEnd, b.String()})
+	}
+	return edits, true
+}
+
+// dropEditsWithin removes the removal edits that lie inside [start, end).
+func dropEditsWithin(edits []jsonEdit, start, end int) []jsonEdit {
+	var result []jsonEdit
+	for _, e := range edits {
+		if e.start < start || e.end > end {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func hasJSONMember(members []jsonMember, key string) bool {
+	for _, m := range members {
+		if m.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeJSONValue encodes value like marshalWithoutHTMLescaping, indented for
+// a member at indent, or on one line for a compact document.
+func encodeJSONValue(value interface{}, indent, unit string, multiline bool) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if multiline {
+		encoder.SetIndent(indent, unit)
+	}
+	if err := encoder.Encode(value); err != nil {
+		return "null"
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// scanJSONObject returns the members of the object starting at src[open] and
+// the end of the object.
+func scanJSONObject(src string, open int) ([]jsonMember, int, bool) {
+	var members []jsonMember
+	pos := skipJSONSpace(src, open+1)
+	if pos < len(src) && src[pos] == '}' {
+		return nil, pos + 1, true
+	}
+	for pos < len(src) {
+		keyEnd, ok := scanJSONValue(src, pos)
+		if !ok || src[pos] != '"' {
+			return nil, 0, false
+		}
+		var key string
+		if json.Unmarshal([]byte(src[pos:keyEnd]), &key) != nil {
+			return nil, 0, false
+		}
+		colon := skipJSONSpace(src, keyEnd)
+		if colon >= len(src) || src[colon] != ':' {
+			return nil, 0, false
+		}
+		valueStart := skipJSONSpace(src, colon+1)
+		valueEnd, ok := scanJSONValue(src, valueStart)
+		if !ok {
+			return nil, 0, false
+		}
+		members = append(members, jsonMember{key, pos, valueStart, valueEnd})
+
+		pos = skipJSONSpace(src, valueEnd)
+		if pos >= len(src) {
+			break
+		}
+		switch src[pos] {
+		case '}':
+			return members, pos + 1, true
+		case ',':
+			pos = skipJSONSpace(src, pos+1)
+		default:
+			return nil, 0, false
+		}
+	}
+	return nil, 0, false
+}
+
+// scanJSONValue returns the end of the JSON value starting at src[pos].
+func scanJSONValue(src string, pos int) (int, bool) {
+	if pos >= len(src) {
+		return 0, false
+	}
+	switch src[pos] {
+	case '"':
+		for i := pos + 1; i < len(src); i++ {
+			switch src[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, true
+			}
+		}
+		return 0, false
+	case '{', '[':
+		depth := 0
+		for i := pos; i < len(src); i++ {
+			switch src[i] {
+			case '"':
+				end, ok := scanJSONValue(src, i)
+				if !ok {
+					return 0, false
+				}
+				i = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1, true
+				}
+			}
+		}
+		return 0, false
+	}
+	end := pos
+	for end < len(src) && !strings.ContainsRune(",}] \t\r\n", rune(src[end])) {
+		end++
+	}
+	return end, end > pos
+}
+
+func skipJSONSpace(src string, pos int) int {
+	for pos < len(src) && strings.ContainsRune(" \t\r\n", rune(src[pos])) {
+		pos++
+	}
+	return pos
+}
+
+// lineIndent returns the whitespace at the start of the line of pos.
+func lineIndent(src string, pos int) string {
+	lineStart := strings.LastIndex(src[:pos], "\n") + 1
+	end := lineStart
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return src[lineStart:end]
+}
+
+// jsonIndentUnit returns the indentation of the first indented line, two
+// spaces by default.
+func jsonIndentUnit(src string) string {
+	for _, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+func isMultiline(src string, start, end int) bool {
+	return strings.Contains(src[start:end], "\n")
+}
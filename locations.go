@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// locationVersion is the version found at a configured version location and
+// its position in the file content.
+type locationVersion struct {
+	location   VersionLocation
+	path       string
+	version    string
+	start, end int
+}
+
+// label names the location in logs and reports, e.g. "package.json (json:version)".
+func (l VersionLocation) label() string {
+	if l.Type != "" {
+		return l.File + " (" + l.Type + ")"
+	}
+	return l.File
+}
+
+// locationRegex returns the regex whose first group is the version, for a
+// pattern or one of the known PHP and header types.
+func (l VersionLocation) locationRegex() (*regexp.Regexp, error) {
+	if l.Pattern != "" {
+		re, err := regexp.Compile(l.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s", t("error.version_location_pattern", l.label(), err))
+		}
+		if re.NumSubexp() != 1 {
+			return nil, fmt.Errorf("%s", t("error.version_location_group", l.label()))
+		}
+		return re, nil
+	}
+	kind, name, _ := strings.Cut(l.Type, ":")
+	switch {
+	case kind == "header" && name == "":
+		return regexp.MustCompile(`(?m)^[ \t/*#@]*Version:[ \t]*(` + versionPattern + `)`), nil
+	case kind == "const" && name != "":
+		return regexp.MustCompile(`\bconst\s+` + regexp.QuoteMeta(name) + `\s*=\s*['"](` + versionPattern + `)['"]`), nil
+	case kind == "define" && name != "":
+		return regexp.MustCompile(`define\s*\(\s*['"]` + regexp.QuoteMeta(name) + `['"]\s*,\s*['"](` + versionPattern + `)['"]\s*\)`), nil
+	}
+	return nil, fmt.Errorf("%s", t("error.version_location_type", l.label()))
+}
+
+// findLocationVersion returns the version at location l in content.
+func findLocationVersion(content string, l VersionLocation) (version string, start int, end int, err error) {
+	if kind, key, _ := strings.Cut(l.Type, ":"); l.Pattern == "" && kind == "json" {
+		if key == "" {
+			key = "version"
+		}
+		start, end, ok := findJSONStringValue(content, strings.Split(key, "."))
+		if !ok {
+			return "", 0, 0, fmt.Errorf("%s", t("error.version_location_not_found", l.label()))
+		}
+		return content[start:end], start, end, nil
+	}
+
+	re, err := l.locationRegex()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	m := re.FindStringSubmatchIndex(content)
+	if len(m) < 4 || m[2] < 0 {
+		return "", 0, 0, fmt.Errorf("%s", t("error.version_location_not_found", l.label()))
+	}
+	return content[m[2]:m[3]], m[2], m[3], nil
+}
+
+// findJSONStringValue returns the position of the string value at the object
+// key path in a JSON document, without the quotes. Only the value is located,
+// so it can be replaced without reformatting the file.
+func findJSONStringValue(content string, path []string) (int, int, bool) {
+	type frame struct {
+		object    bool
+		expectKey bool
+		key       string
+	}
+	var stack []*frame
+	valueDone := func() {
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+	atPath := func() bool {
+		if len(stack) != len(path) {
+			return false
+		}
+		for i, f := range stack {
+			if !f.object || f.key != path[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	dec := json.NewDecoder(strings.NewReader(content))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, false
+		}
+		if d, ok := tok.(json.Delim); ok {
+			if d == '{' || d == '[' {
+				stack = append(stack, &frame{object: d == '{', expectKey: d == '{'})
+			} else {
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+			continue
+		}
+		if len(stack) > 0 && stack[len(stack)-1].object && stack[len(stack)-1].expectKey {
+			stack[len(stack)-1].key, _ = tok.(string)
+			stack[len(stack)-1].expectKey = false
+			continue
+		}
+		if _, ok := tok.(string); ok && atPath() {
+			end := int(dec.InputOffset()) - 1
+			start := strings.LastIndex(content[:end], `"`) + 1
+			return start, end, true
+		}
+		valueDone()
+	}
+}
+
+// readVersionLocations reads the versions of all locations configured in
+// version_locations.
+func readVersionLocations(workDir string, locations []VersionLocation) ([]locationVersion, error) {
+	var found []locationVersion
+	for _, l := range locations {
+		path, err := safeJoinWithinBase(workDir, l.File)
+		if err != nil {
+			return nil, err
+		}
+		logOpenedFile(path)
+		content, err := readReleaseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s", t("error.version_location_read", l.label(), err))
+		}
+		version, start, end, err := findLocationVersion(string(content), l)
+		if err != nil {
+			return nil, err
+		}
+		logVerbose(t("log.version_location_found", l.label(), version))
+		found = append(found, locationVersion{location: l, path: path, version: version, start: start, end: end})
+	}
+	return found, nil
+}
+
+// highestLocationVersion returns the highest version of the locations.
+func highestLocationVersion(found []locationVersion) string {
+	highest := ""
+	for _, f := range found {
+		highest = getHigherVersion(highest, f.version)
+	}
+	return highest
+}
+
+// syncVersionLocations writes version to every configured location that
+// holds a different one. Each location is read again, as an earlier location
+// may have changed the same file.
+func syncVersionLocations(workDir string, locations []VersionLocation, version string) error {
+	for _, l := range locations {
+		found, err := readVersionLocations(workDir, []VersionLocation{l})
+		if err != nil {
+			return err
+		}
+		f := found[0]
+		if f.version == version {
+			continue
+		}
+		content, err := readReleaseFile(f.path)
+		if err != nil {
+			return fmt.Errorf("%s", t("error.version_location_read", l.label(), err))
+		}
+		updated := string(content[:f.start]) + version + string(content[f.end:])
+		if err := writeReleaseFile(f.path, []byte(updated), 0644); err != nil {
+			return err
+		}
+		logVerbose(t("log.version_location_updated", l.label(), version))
+	}
+	return nil
+}
@@ -10,6 +10,10 @@ import (
 
 var verbose bool
 
+// console receives all human readable output. With -json it is stderr, so
+// stdout only carries the report.
+var console io.Writer = os.Stdout
+
 func logVerbose(message string) {
 	if verbose && message != "" {
 		logAndPrint(message)
@@ -31,7 +35,7 @@ func runSystemCommand(workDir, name string, args ...string) error {
 		cmd.Dir = workDir
 	}
 	if verbose {
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = console
 		cmd.Stderr = os.Stderr
 	}
 	return cmd.Run()
@@ -47,7 +51,7 @@ func runGitCommandOutput(workDir string, args ...string) ([]byte, error) {
 		cmd := exec.Command("git", args...)
 		cmd.Dir = workDir
 		var stdout bytes.Buffer
-		cmd.Stdout = io.MultiWriter(os.Stdout, &stdout)
+		cmd.Stdout = io.MultiWriter(console, &stdout)
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err != nil {
 			return stdout.Bytes(), err
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdHeadingRegex  = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+	mdListItemRegex = regexp.MustCompile(`^[ \t]*([-*+]|\d+[.)])[ \t]+(.*)$`)
+	mdRuleRegex     = regexp.MustCompile(`^[ \t]*(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	mdImageRegex    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	mdLinkRegex     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdStrongRegex   = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	mdEmRegex       = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*|\b_(\S(?:[^_]*?\S)?)_\b`)
+)
+
+// markdownToHTML renders the Markdown used for plugin details: headings,
+// paragraphs, lists, block quotes, rules, fenced code and the inline code,
+// emphasis, links and images. Raw HTML is escaped like in the changelog.
+func markdownToHTML(markdown string) string {
+	markdown = strings.ReplaceAll(markdown, "\r\n", "\n")
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r", "\n"), "\n")
+
+	var b strings.Builder
+	var paragraph, quote []string
+	var listTag string
+	var items []string
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + markdownInline(paragraph) + "</p>")
+			paragraph = nil
+		}
+	}
+	flushQuote := func() {
+		if len(quote) > 0 {
+			b.WriteString("<blockquote><p>" + markdownInline(quote) + "</p></blockquote>")
+			quote = nil
+		}
+	}
+	flushList := func() {
+		if listTag == "" {
+			return
+		}
+		b.WriteString("<" + listTag + ">")
+		for _, item := range items {
+			b.WriteString("<li>" + markdownInline(strings.Split(item, "\n")) + "</li>")
+		}
+		b.WriteString("</" + listTag + ">")
+		listTag, items = "", nil
+	}
+	flush := func() {
+		flushParagraph()
+		flushQuote()
+		flushList()
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			fence := trimmed[:3]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+		case trimmed == "":
+			flush()
+		case mdHeadingRegex.MatchString(trimmed):
+			flush()
+			m := mdHeadingRegex.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			b.WriteString("<h" + level + ">" + markdownInline([]string{m[2]}) + "</h" + level + ">")
+		case mdRuleRegex.MatchString(line):
+			flush()
+			b.WriteString("<hr>")
+		case mdListItemRegex.MatchString(line):
+			flushParagraph()
+			flushQuote()
+			m := mdListItemRegex.FindStringSubmatch(line)
+			tag := "ul"
+			if m[1][0] >= '0' && m[1][0] <= '9' {
+				tag = "ol"
+			}
+			if tag != listTag {
+				flushList()
+				listTag = tag
+			}
+			items = append(items, m[2])
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			flushList()
+			quote = append(quote, strings.TrimSpace(strings.TrimPrefix(trimmed, ">")))
+		case listTag != "" && line != trimmed:
+			// An indented line continues the list item.
+			items[len(items)-1] += "\n" + trimmed
+		default:
+			flushQuote()
+			flushList()
+			paragraph = append(paragraph, strings.TrimLeft(line, " \t"))
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// markdownInline renders the lines of a block with inline code, emphasis,
+// links and images. A line ending in two spaces ends with a line break.
+func markdownInline(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		hardBreak := strings.HasSuffix(line, "  ")
+		b.WriteString(markdownSpans(strings.TrimSpace(line)))
+		if i < len(lines)-1 {
+			if hardBreak {
+				b.WriteString("<br>")
+			} else {
+				b.WriteString(" ")
+			}
+		}
+	}
+	return b.String()
+}
+
+// markdownSpans renders one line; text in backticks is only escaped.
+func markdownSpans(text string) string {
+	parts := strings.Split(text, "`")
+	if len(parts)%2 == 0 {
+		// An unmatched backtick is kept as text.
+		parts[len(parts)-2] += "`" + parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+	}
+	var b strings.Builder
+	for i, part := range parts {
+		if i%2 == 1 {
+			b.WriteString("<code>" + html.EscapeString(part) + "</code>")
+			continue
+		}
+		s := html.EscapeString(part)
+		s = mdImageRegex.ReplaceAllStringFunc(s, func(m string) string {
+			sm := mdImageRegex.FindStringSubmatch(m)
+			if !safeMarkdownURL(sm[2]) {
+				return sm[1]
+			}
+			return `<img src="` + sm[2] + `" alt="` + sm[1] + `">`
+		})
+		s = mdLinkRegex.ReplaceAllStringFunc(s, func(m string) string {
+			sm := mdLinkRegex.FindStringSubmatch(m)
+			if !safeMarkdownURL(sm[2]) {
+				return sm[1]
+			}
+			return `<a href="` + sm[2] + `">` + sm[1] + `</a>`
+		})
+		s = mdStrongRegex.ReplaceAllString(s, "<strong>$1$2</strong>")
+		s = mdEmRegex.ReplaceAllString(s, "<em>$1$2</em>")
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// safeMarkdownURL rejects script URLs in links and images.
+func safeMarkdownURL(url string) bool {
+	scheme, _, found := strings.Cut(strings.ToLower(html.UnescapeString(url)), ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	return scheme == "http" || scheme == "https" || scheme == "mailto"
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var upgradeNoticeHeading = regexp.MustCompile(`(?im)^###[ \t]*Upgrade[ \t]+Notice[ \t]*$`)
+
+// upgradeNoticeRange returns the position of the "### Upgrade Notice"
+// sub-section in a changelog section, from its heading to the next "###"
+// heading or the end.
+func upgradeNoticeRange(section string) (start, bodyStart, end int, ok bool) {
+	m := upgradeNoticeHeading.FindStringIndex(section)
+	if m == nil {
+		return 0, 0, 0, false
+	}
+	end = len(section)
+	if next := regexp.MustCompile(`(?m)^###?[ \t]`).FindStringIndex(section[m[1]:]); next != nil {
+		end = m[1] + next[0]
+	}
+	return m[0], m[1], end, true
+}
+
+// stripUpgradeNotice returns a changelog section without its "### Upgrade
+// Notice" sub-section, which is not part of the changelog text.
+func stripUpgradeNotice(section string) string {
+	start, _, end, ok := upgradeNoticeRange(section)
+	if !ok {
+		return section
+	}
+	return strings.TrimSpace(section[:start] + section[end:])
+}
+
+// upgradeNoticeText joins the lines of a notice to one line of text; list
+// markers are dropped.
+func upgradeNoticeText(body string) string {
+	var parts []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimLeft(line, "-*"))
+		if line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// readUpgradeNotice returns the upgrade notice of version from its
+// "### Upgrade Notice" sub-section in Changelog.md, or "".
+func readUpgradeNotice(workDir string, version string) (string, error) {
+	section, err := readChangelog(workDir, version)
+	if err != nil {
+		return "", err
+	}
+	_, bodyStart, end, ok := upgradeNoticeRange(section)
+	if !ok {
+		return "", nil
+	}
+	return upgradeNoticeText(section[bodyStart:end]), nil
+}
+
+// writeUpgradeNotice sets the "### Upgrade Notice" sub-section of version in
+// Changelog.md to notice. Without a section for version nothing is written.
+func writeUpgradeNotice(workDir string, version string, notice string) error {
+	changelogPath := changelogPathForWorkDir(workDir)
+	if !releaseFileExists(changelogPath) {
+		return nil
+	}
+	content, err := readReleaseFile(changelogPath)
+	if err != nil {
+		return err
+	}
+	contentStr := string(content)
+	_, sectionEnd, headerLineEnd, ok := findVersionSectionRange(contentStr, version)
+	if !ok {
+		return nil
+	}
+
+	subsection := "### Upgrade Notice\n\n" + notice + "\n"
+	section := contentStr[headerLineEnd:sectionEnd]
+	if start, _, end, found := upgradeNoticeRange(section); found {
+		if end < len(section) {
+			subsection += "\n"
+		}
+		section = section[:start] + subsection + section[end:]
+	} else if body := strings.TrimRight(section, "\n"); strings.TrimSpace(body) == "" {
+		section = "\n" + subsection
+	} else {
+		section = body + "\n\n" + subsection
+	}
+	// Keep a blank line before the next version.
+	if sectionEnd < len(contentStr) && !strings.HasSuffix(section, "\n\n") {
+		section += "\n"
+	}
+	updated := contentStr[:headerLineEnd] + section + contentStr[sectionEnd:]
+	if updated == contentStr {
+		return nil
+	}
+	return writeReleaseFile(changelogPath, []byte(updated), 0644)
+}
+
+// syncUpgradeNotice puts the upgrade notice of the current version, from
+// -upgrade-notice or Changelog.md, into update_info.json and clears the
+// notice of an earlier version. Errors are only logged.
+func (ctx *releaseContext) syncUpgradeNotice() {
+	notice := strings.TrimSpace(ctx.opts.upgradeNotice)
+	if notice != "" {
+		if err := writeUpgradeNotice(ctx.workDir, ctx.currentVersion, notice); err != nil {
+			logAndPrint(t("error.changelog_write", err))
+		}
+	} else {
+		var err error
+		if notice, err = readUpgradeNotice(ctx.workDir, ctx.currentVersion); err != nil {
+			logAndPrint(t("error.changelog_read", err))
+			return
+		}
+	}
+
+	switch {
+	case notice != "":
+		logVerbose(t("log.upgrade_notice_set", ctx.currentVersion, notice))
+	case ctx.updateInfo.Upgrade_notice != "":
+		logVerbose(t("log.upgrade_notice_cleared", ctx.currentVersion))
+	}
+	ctx.updateInfo.Upgrade_notice = notice
+}
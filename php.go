@@ -0,0 +1,398 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// phpTokenKind is the kind of a token found by lexPHP.
+type phpTokenKind int
+
+const (
+	phpInlineHTML phpTokenKind = iota
+	phpOpenTag
+	phpCloseTag
+	phpWhitespace
+	phpComment
+	phpString
+	phpVariable
+	phpIdent
+	phpSymbol
+)
+
+// phpToken is a token of a PHP file and its position in the content.
+type phpToken struct {
+	kind       phpTokenKind
+	text       string
+	start, end int
+}
+
+// lexPHP splits PHP source into the tokens needed to find the header,
+// version property and define calls: comments, strings (including heredoc
+// and nowdoc), variables, identifiers and single symbols. Consecutive line
+// comments form one comment token, so a header written with // is one token.
+func lexPHP(src string) []phpToken {
+	var tokens []phpToken
+	emit := func(kind phpTokenKind, start, end int) {
+		tokens = append(tokens, phpToken{kind, src[start:end], start, end})
+	}
+
+	inPHP := false
+	i := 0
+	for i < len(src) {
+		start := i
+		if !inPHP {
+			j := strings.Index(src[i:], "<?")
+			if j < 0 {
+				emit(phpInlineHTML, i, len(src))
+				break
+			}
+			if j > 0 {
+				emit(phpInlineHTML, i, i+j)
+			}
+			i += j
+			end := i + 2
+			if strings.HasPrefix(strings.ToLower(src[i:]), "<?php") {
+				end = i + 5
+			} else if strings.HasPrefix(src[i:], "<?=") {
+				end = i + 3
+			}
+			emit(phpOpenTag, i, end)
+			i = end
+			inPHP = true
+			continue
+		}
+
+		c := src[i]
+		switch {
+		case strings.HasPrefix(src[i:], "?>"):
+			i += 2
+			emit(phpCloseTag, start, i)
+			inPHP = false
+		case isPHPSpace(c):
+			for i < len(src) && isPHPSpace(src[i]) {
+				i++
+			}
+			emit(phpWhitespace, start, i)
+		case strings.HasPrefix(src[i:], "/*"):
+			if j := strings.Index(src[i+2:], "*/"); j >= 0 {
+				i += 2 + j + 2
+			} else {
+				i = len(src)
+			}
+			emit(phpComment, start, i)
+		case isPHPLineComment(src[i:]):
+			i = phpLineCommentEnd(src, i)
+			for {
+				j := i
+				if j < len(src) && src[j] == '\r' {
+					j++
+				}
+				if j >= len(src) || src[j] != '\n' {
+					break
+				}
+				j++
+				for j < len(src) && (src[j] == ' ' || src[j] == '\t') {
+					j++
+				}
+				if !isPHPLineComment(src[j:]) {
+					break
+				}
+				i = phpLineCommentEnd(src, j)
+			}
+			emit(phpComment, start, i)
+		case c == '\'' || c == '"' || c == '`':
+			i = phpQuotedEnd(src, i)
+			emit(phpString, start, i)
+		case strings.HasPrefix(src[i:], "<<<"):
+			i = phpHeredocEnd(src, i)
+			emit(phpString, start, i)
+		case c == '$' && i+1 < len(src) && isPHPIdentChar(src[i+1]):
+			i++
+			for i < len(src) && isPHPIdentChar(src[i]) {
+				i++
+			}
+			emit(phpVariable, start, i)
+		case isPHPIdentChar(c) || c == '\\':
+			for i < len(src) && (isPHPIdentChar(src[i]) || src[i] == '\\') {
+				i++
+			}
+			emit(phpIdent, start, i)
+		default:
+			i++
+			emit(phpSymbol, start, i)
+		}
+	}
+	return tokens
+}
+
+// lexCSS splits a stylesheet such as the style.css of a theme into comments,
+// strings, whitespace and single symbols, using the token kinds of lexPHP.
+func lexCSS(src string) []phpToken {
+	var tokens []phpToken
+	for i := 0; i < len(src); {
+		start := i
+		kind := phpSymbol
+		switch c := src[i]; {
+		case isPHPSpace(c):
+			for i < len(src) && isPHPSpace(src[i]) {
+				i++
+			}
+			kind = phpWhitespace
+		case strings.HasPrefix(src[i:], "/*"):
+			if j := strings.Index(src[i+2:], "*/"); j >= 0 {
+				i += 2 + j + 2
+			} else {
+				i = len(src)
+			}
+			kind = phpComment
+		case c == '\'' || c == '"':
+			i = phpQuotedEnd(src, i)
+			kind = phpString
+		default:
+			i++
+		}
+		tokens = append(tokens, phpToken{kind, src[start:i], start, i})
+	}
+	return tokens
+}
+
+// lexSource lexes a file with a header comment: PHP files, recognized by
+// their open tag, with lexPHP and everything else, like style.css, as CSS.
+func lexSource(src string) []phpToken {
+	if strings.Contains(src, "<?") {
+		return lexPHP(src)
+	}
+	return lexCSS(src)
+}
+
+func isPHPSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isPHPIdentChar(c byte) bool {
+	return c == '_' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// isPHPLineComment reports whether s starts with // or #, but not with a
+// #[ attribute.
+func isPHPLineComment(s string) bool {
+	return strings.HasPrefix(s, "//") || (strings.HasPrefix(s, "#") && !strings.HasPrefix(s, "#["))
+}
+
+// phpLineCommentEnd returns the end of the line comment at i, which is the
+// line break or a closing ?> tag.
+func phpLineCommentEnd(src string, i int) int {
+	end := len(src)
+	if j := strings.IndexByte(src[i:], '\n'); j >= 0 {
+		end = i + j
+	}
+	if j := strings.Index(src[i:end], "?>"); j >= 0 {
+		end = i + j
+	}
+	if end > i && src[end-1] == '\r' {
+		end--
+	}
+	return end
+}
+
+func phpQuotedEnd(src string, i int) int {
+	quote := src[i]
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+// phpHeredocEnd returns the end of the heredoc or nowdoc starting at i. The
+// closing identifier may be indented (PHP 7.3).
+func phpHeredocEnd(src string, i int) int {
+	m := regexp.MustCompile(`^<<<[ \t]*(["']?)([A-Za-z_][A-Za-z0-9_]*)(["']?)\r?\n`).FindStringSubmatch(src[i:])
+	if m == nil {
+		return i + 3
+	}
+	id := m[2]
+	for j := i + len(m[0]); j < len(src); {
+		lineStart := j
+		for j < len(src) && (src[j] == ' ' || src[j] == '\t') {
+			j++
+		}
+		if strings.HasPrefix(src[j:], id) && (j+len(id) == len(src) || !isPHPIdentChar(src[j+len(id)])) {
+			return j + len(id)
+		}
+		next := strings.IndexByte(src[lineStart:], '\n')
+		if next < 0 {
+			break
+		}
+		j = lineStart + next + 1
+	}
+	return len(src)
+}
+
+// headerVersionRegex matches the Version: line of a header comment.
+var headerVersionRegex = regexp.MustCompile(`(?m)^[ \t/*#@]*Version:[ \t]*(` + versionPattern + `)`)
+
+// findHeaderComment returns the header comment: the first comment within the
+// first 8 KB that contains marker, as WordPress reads it. Comments later in
+// the file, e.g. docblocks of bundled libraries, and text inside strings are
+// never taken for the header.
+func findHeaderComment(tokens []phpToken, marker string) (phpToken, bool) {
+	for _, tok := range tokens {
+		if tok.start >= 8192 {
+			break
+		}
+		if tok.kind == phpComment && strings.Contains(tok.text, marker) {
+			return tok, true
+		}
+	}
+	return phpToken{}, false
+}
+
+// headerMarkers are the fields that mark the header comment of a plugin and
+// of a theme's style.css.
+var headerMarkers = []string{"Plugin Name:", "Theme Name:"}
+
+// findPHPHeader returns the header comment of a plugin or theme. A file
+// without "Plugin Name:" or "Theme Name:" uses its first comment if that has
+// a Version: line.
+func findPHPHeader(tokens []phpToken) (phpToken, bool) {
+	for _, marker := range headerMarkers {
+		if tok, ok := findHeaderComment(tokens, marker); ok {
+			return tok, true
+		}
+	}
+	for _, tok := range tokens {
+		if tok.kind == phpComment {
+			return tok, headerVersionRegex.MatchString(tok.text)
+		}
+	}
+	return phpToken{}, false
+}
+
+// headerCommentBody returns the range of a header comment without its
+// closing */.
+func headerCommentBody(tok phpToken) (int, int) {
+	if strings.HasPrefix(tok.text, "/*") && strings.HasSuffix(tok.text, "*/") {
+		return tok.start, tok.end - 2
+	}
+	return tok.start, tok.end
+}
+
+// significantPHPTokens drops whitespace and comments.
+func significantPHPTokens(tokens []phpToken) []phpToken {
+	var out []phpToken
+	for _, tok := range tokens {
+		if tok.kind != phpWhitespace && tok.kind != phpComment {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+// phpStringValue returns the value of a plain single or double quoted string
+// token and its position in the content.
+func phpStringValue(tok phpToken) (string, int, int, bool) {
+	if tok.kind != phpString || len(tok.text) < 2 || (tok.text[0] != '\'' && tok.text[0] != '"') {
+		return "", 0, 0, false
+	}
+	return tok.text[1 : len(tok.text)-1], tok.start + 1, tok.end - 1, true
+}
+
+var exactVersionRegex = regexp.MustCompile(`^` + versionPattern + `$`)
+
+// findVersionProperty finds the first "private $version = '1.2.3';" of a
+// class. Other visibilities, static and readonly are accepted as well.
+func findVersionProperty(tokens []phpToken) (string, int, int, bool) {
+	code := significantPHPTokens(tokens)
+	for i, tok := range code {
+		if tok.kind != phpIdent {
+			continue
+		}
+		switch strings.ToLower(tok.text) {
+		case "private", "protected", "public", "var":
+		default:
+			continue
+		}
+		j := i + 1
+		for j < len(code) && (code[j].kind == phpIdent || code[j].text == "?") {
+			j++
+		}
+		if j+2 >= len(code) || code[j].text != "$version" || code[j+1].text != "=" {
+			continue
+		}
+		if value, start, end, ok := phpStringValue(code[j+2]); ok && exactVersionRegex.MatchString(value) {
+			return value, start, end, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+var defineVersionNameRegex = regexp.MustCompile(`^([A-Z_]+)_VERSION$`)
+
+// findVersionDefine finds the first define('X_VERSION', '1.2.3') call and
+// returns X together with the version.
+func findVersionDefine(tokens []phpToken) (string, string, int, int, bool) {
+	code := significantPHPTokens(tokens)
+	for i := 0; i+5 < len(code); i++ {
+		if code[i].kind != phpIdent || !strings.EqualFold(code[i].text, "define") || code[i+1].text != "(" {
+			continue
+		}
+		name, _, _, ok := phpStringValue(code[i+2])
+		m := defineVersionNameRegex.FindStringSubmatch(name)
+		if !ok || m == nil || code[i+3].text != "," || code[i+5].text != ")" {
+			continue
+		}
+		if value, start, end, ok := phpStringValue(code[i+4]); ok && exactVersionRegex.MatchString(value) {
+			return m[1], value, start, end, true
+		}
+	}
+	return "", "", 0, 0, false
+}
+
+// setHeaderLastUpdate sets the Last-Update: line of the header comment to
+// date. A missing line is added below the Version: line with the same prefix
+// and, if the header aligns its values, at the same column. It reports
+// whether the line was added and whether the header has a Last-Update: or
+// Version: line at all.
+func setHeaderLastUpdate(content string, date string) (string, bool, bool) {
+	tok, ok := findPHPHeader(lexSource(content))
+	if !ok {
+		return content, false, false
+	}
+	start, end := headerCommentBody(tok)
+	header := content[start:end]
+
+	// The whole value is replaced, as timestamp_format may be any layout.
+	lastUpdateRegex := regexp.MustCompile(`(?m)^[ \t/*#@]*Last-Update:[ \t]*([^\r\n]*?)[ \t]*$`)
+	if m := lastUpdateRegex.FindStringSubmatchIndex(header); m != nil {
+		return content[:start+m[2]] + date + content[start+m[3]:], false, true
+	}
+
+	m := regexp.MustCompile(`(?m)^([ \t/*#@]*)Version:([ \t]*)` + versionPattern).FindStringSubmatchIndex(header)
+	if m == nil {
+		return content, false, false
+	}
+	prefix := header[m[2]:m[3]]
+	// A Version: on the first line of the comment is continued with " *".
+	prefix = strings.Replace(strings.Replace(prefix, "/**", "  *", 1), "/*", " *", 1)
+	padding := " "
+	if gap := len("Version:") + m[5] - m[4] - len("Last-Update:"); m[5]-m[4] > 1 && gap > 1 {
+		padding = strings.Repeat(" ", gap)
+	}
+	lineEnd := len(header)
+	newline := "\n"
+	if j := strings.IndexByte(header[m[1]:], '\n'); j >= 0 {
+		lineEnd = m[1] + j
+		if lineEnd > 0 && header[lineEnd-1] == '\r' {
+			lineEnd--
+			newline = "\r\n"
+		}
+	}
+	pos := start + lineEnd
+	return content[:pos] + newline + prefix + "Last-Update:" + padding + date + content[pos:], true, true
+}
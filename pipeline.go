@@ -0,0 +1,504 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/janmz/sconfig"
+)
+
+// releaseContext carries the state of one plugin release through the stages
+// of the pipeline.
+type releaseContext struct {
+	workDir        string
+	opts           *cliOptions
+	config         ConfigType
+	updateInfoPath string
+	updateInfo     *UpdateInfo
+	allData        map[string]interface{}
+	currentVersion string
+	timestamp      string
+	changelogText  string
+	zipFileName    string
+	zipPath        string
+
+	previousVersion string
+	uploadStatus    string
+	gitStatus       string
+	sshPool         *sshClientPool
+
+	journal          *releaseJournal
+	feedUploaded     bool
+	feedRemoteURL    string
+	releaseCommitted bool
+	rolledBack       bool
+
+	// The update info file the server served before the upload.
+	remoteFeed        []byte
+	remoteFeedSaved   bool
+	remoteFeedMissing bool
+
+	detectedVersions map[string]string
+	zipFiles         []string
+	uploadedFiles    []string
+	gitCommit        string
+	gitTag           string
+}
+
+// Results of the upload and git stages, reported in the workspace summary.
+const (
+	stageSkipped = "skipped"
+	stagePlanned = "planned"
+	stageDone    = "done"
+	stageFailed  = "failed"
+)
+
+// newReleaseContext reads update.config and the update_info file of the
+// selected channel of the plugin in workDir.
+func newReleaseContext(workDir string, opts *cliOptions) (*releaseContext, error) {
+	ctx := &releaseContext{workDir: workDir, opts: opts}
+
+	updateConfigPath := filepath.Join(workDir, "update.config")
+	if err := sconfig.LoadConfig(&ctx.config, 2, updateConfigPath, false, false); err != nil {
+		return nil, fmt.Errorf("%s", t("error.config_read", err))
+	}
+	if err := ctx.config.validateType(); err != nil {
+		return nil, err
+	}
+	timestamp, err := ctx.config.releaseTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	ctx.timestamp = timestamp
+
+	updateInfoPath, updateInfo, allData, err := loadChannelUpdateInfo(workDir, &ctx.config, opts.channel)
+	if err != nil && opts.command == "validate" {
+		// validate reads the file itself to report every problem with its
+		// position, including syntax errors.
+		if name, nameErr := channelUpdateInfoFile(&ctx.config, opts.channel); nameErr == nil {
+			ctx.updateInfoPath = filepath.Join(workDir, "Updates", name)
+			ctx.updateInfo = &UpdateInfo{}
+			return ctx, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s", t("error.update_info_read", err))
+	}
+	ctx.updateInfoPath = updateInfoPath
+	ctx.updateInfo = updateInfo
+	ctx.allData = allData
+	ctx.previousVersion = updateInfo.Version
+	return ctx, nil
+}
+
+// runCommand runs cmd as a transaction. If it fails, every local file it
+// changed is restored, and an update info file that was already uploaded is
+// uploaded again in its previous state. Nothing is restored once the release
+// has been committed to git, and a command that changed nothing, like
+// verify, has nothing to roll back.
+func (ctx *releaseContext) runCommand(cmd *cliCommand) error {
+	ctx.journal = startJournal(ctx.workDir)
+	defer ctx.journal.close()
+
+	err := cmd.run(ctx)
+	if err != nil && !dryRun && (!ctx.journal.empty() || ctx.feedUploaded) {
+		if ctx.releaseCommitted {
+			logAndPrint(t("log.rollback_committed"))
+		} else {
+			ctx.rollback()
+		}
+	}
+	return err
+}
+
+// rollback restores the state before the command. Errors are only logged,
+// the original error is what the user needs to see.
+func (ctx *releaseContext) rollback() {
+	logAndPrint(t("log.rollback_start"))
+	ctx.rolledBack = true
+	if err := ctx.journal.restore(); err != nil {
+		logAndPrint(t("error.rollback_local", err))
+	}
+	if !ctx.feedUploaded {
+		return
+	}
+	name := filepath.Base(ctx.updateInfoPath)
+	data := ctx.remoteFeed
+	switch {
+	case ctx.remoteFeedMissing:
+		logAndPrint(t("log.rollback_remote_new_feed", name))
+		return
+	case !ctx.remoteFeedSaved:
+		// The served copy could not be saved, the restored local file is the
+		// best guess of what the server had.
+		changed, existed := ctx.journal.recorded(ctx.updateInfoPath)
+		if !changed {
+			return
+		}
+		if !existed {
+			logAndPrint(t("log.rollback_remote_new_feed", name))
+			return
+		}
+		var err error
+		if data, err = os.ReadFile(ctx.updateInfoPath); err != nil {
+			logAndPrint(t("error.rollback_remote", err))
+			return
+		}
+		logAndPrint(t("log.rollback_remote_local", name))
+	}
+	if err := restoreRemoteUpdateInfo(&ctx.config, data, name, ctx.workDir, ctx.feedRemoteURL, ctx.opts.fetchHostKey, ctx.sshPool); err != nil {
+		logAndPrint(t("error.rollback_remote", err))
+		return
+	}
+	logAndPrint(t("log.rollback_remote_done", name))
+}
+
+// detectVersion reads the current version from the main PHP file and the
+// configured version locations without rewriting them.
+func (ctx *releaseContext) detectVersion() error {
+	ctx.recordDetectedVersions()
+	currentVersion, err := detectPluginVersion(ctx.workDir, ctx.config.mainFile())
+	if err != nil {
+		return fmt.Errorf("%s", t("error.php_processing", err))
+	}
+	locations, err := readVersionLocations(ctx.workDir, ctx.config.VersionLocations)
+	if err != nil {
+		return err
+	}
+	ctx.currentVersion = getHigherVersion(currentVersion, highestLocationVersion(locations))
+	logAndPrint(t("log.current_version_detected", currentVersion))
+	return nil
+}
+
+// recordDetectedVersions keeps the versions found in each location for the
+// report, before they are synchronized.
+func (ctx *releaseContext) recordDetectedVersions() {
+	ctx.detectedVersions = map[string]string{}
+	if ctx.previousVersion != "" {
+		ctx.detectedVersions["update_info"] = ctx.previousVersion
+	}
+	if locations, err := readVersionLocations(ctx.workDir, ctx.config.VersionLocations); err == nil {
+		for _, l := range locations {
+			ctx.detectedVersions[l.location.label()] = l.version
+		}
+	}
+	versions, err := readPHPVersions(ctx.workDir, ctx.config.mainFile())
+	if err != nil {
+		return
+	}
+	for location, version := range map[string]string{
+		"header": versions.comment,
+		"class":  versions.class,
+		"define": versions.define,
+	} {
+		if version != "" {
+			ctx.detectedVersions[location] = version
+		}
+	}
+}
+
+// syncVersion writes the highest version found, or the next version if a bump
+// level was given, to all places in the main PHP file, to the configured
+// version locations, to every block.json and to update_info.json, and points
+// the PUC integration to the update info file.
+func (ctx *releaseContext) syncVersion() error {
+	ctx.recordDetectedVersions()
+	locations, err := readVersionLocations(ctx.workDir, ctx.config.VersionLocations)
+	if err != nil {
+		return err
+	}
+	currentVersion, err := processMainPHPFile(ctx.workDir, ctx.config.mainFile(), ctx.updateInfo, ctx.opts.bumpLevel, ctx.config.MetadataSource, highestLocationVersion(locations), ctx.timestamp)
+	if err != nil {
+		return fmt.Errorf("%s", t("error.php_processing", err))
+	}
+	if ctx.config.pucEnabled() {
+		if err := syncPUCCall(ctx.workDir, ctx.config.pucFile(), ctx.updateInfo, filepath.Base(ctx.updateInfoPath)); err != nil {
+			return fmt.Errorf("%s", t("error.php_processing", err))
+		}
+	} else {
+		logVerbose(t("log.puc_disabled"))
+	}
+	if err := syncVersionLocations(ctx.workDir, ctx.config.VersionLocations, currentVersion); err != nil {
+		return err
+	}
+	if err := syncBlockVersions(ctx.workDir, ctx.config.SkipPattern, currentVersion); err != nil {
+		return err
+	}
+	ctx.currentVersion = currentVersion
+	logAndPrint(t("log.current_version_detected", currentVersion))
+
+	if err := processUpdateInfo(ctx.updateInfo, currentVersion, ctx.timestamp); err != nil {
+		return fmt.Errorf("%s", t("error.update_info_processing", err))
+	}
+	return nil
+}
+
+// updateChangelog asks for the changelog text and writes it to Changelog.md
+// and the changelog section of update_info.json. Errors are only logged.
+func (ctx *releaseContext) updateChangelog() {
+	changelogText, err := processChangelog(ctx.workDir, ctx.currentVersion, ctx.opts.commitMessage)
+	if err != nil {
+		logAndPrint(t("error.changelog_write", err))
+	} else if changelogText != "" {
+		ctx.changelogText = changelogText
+		updateChangelogInUpdateInfo(ctx.workDir, ctx.updateInfo, changelogText)
+	}
+}
+
+// syncReadme updates the header and changelog of readme.txt. Errors are only
+// logged.
+func (ctx *releaseContext) syncReadme() {
+	if err := syncReadmeTxt(ctx.workDir, ctx.currentVersion, ctx.updateInfo, ctx.changelogText); err != nil {
+		logAndPrint(t("error.readme_sync", err))
+	}
+}
+
+// convertSVGs regenerates PNG files from changed SVGs. Errors are only logged.
+func (ctx *releaseContext) convertSVGs() {
+	if err := processSVGFiles(ctx.workDir); err != nil {
+		logAndPrint(t("error.svg_convert", err))
+	}
+}
+
+// buildZip creates the release ZIP and points download_url to it.
+func (ctx *releaseContext) buildZip() error {
+	updateInfo := ctx.updateInfo
+	remoteZIPName := filepath.Base(updateInfo.DownloadURL)
+	re := regexp.MustCompile(zipVersionPattern)
+	remoteZIPName2 := re.ReplaceAllString(remoteZIPName, "")
+	slug := updateInfo.Slug
+	if slug == "" && ctx.config.isTheme() {
+		// The theme update_info format has no slug, the folder decides.
+		slug = themeSlug(ctx.workDir)
+	} else if slug == "" {
+		updateInfo.Slug = remoteZIPName2
+		slug = remoteZIPName2
+	}
+	if re.MatchString(remoteZIPName2) {
+		logAndPrint(t("error.zip_version_remove"))
+		remoteZIPName2 = strings.TrimSuffix(remoteZIPName2, ".zip")
+	}
+
+	ctx.zipFileName = fmt.Sprintf("%s-v%s.zip", remoteZIPName2, ctx.currentVersion)
+	ctx.zipPath = filepath.Join(ctx.workDir, "Updates", ctx.zipFileName)
+	zipFiles, err := createZipFile(ctx.workDir, ctx.zipPath, ctx.config.SkipPattern, slug)
+	if err != nil {
+		return fmt.Errorf("%s", t("error.zip_creation", err))
+	}
+	ctx.zipFiles = zipFiles
+	updateInfo.DownloadURL = strings.TrimSuffix(updateInfo.DownloadURL, remoteZIPName) + ctx.zipFileName
+	logVerbose(t("log.download_url_set", redactSensitiveURL(updateInfo.DownloadURL)))
+	return nil
+}
+
+// saveUpdateInfo writes update_info.json.
+func (ctx *releaseContext) saveUpdateInfo() error {
+	if err := setUpdateInfo(ctx.updateInfo, ctx.allData, ctx.updateInfoPath); err != nil {
+		return fmt.Errorf("%s", t("error.update_info_processing", err))
+	}
+	return nil
+}
+
+// upload copies ZIP, update_info.json, banners and icons to the update server.
+func (ctx *releaseContext) upload() error {
+	if ctx.config.SSHHost == "" || ctx.config.SSHUser == "" {
+		logAndPrint(t("log.no_ssh_config"))
+		ctx.uploadStatus = stageSkipped
+		return nil
+	}
+	if !dryRun {
+		ctx.saveRemoteUpdateInfo()
+	}
+	uploaded, err := uploadFiles(&ctx.config, ctx.zipPath, ctx.updateInfoPath, ctx.workDir, ctx.updateInfo, ctx.opts.fetchHostKey, ctx.sshPool)
+	for _, item := range uploaded {
+		ctx.uploadedFiles = append(ctx.uploadedFiles, item.remotePath)
+		if item.localPath == ctx.updateInfoPath {
+			ctx.feedUploaded = true
+			ctx.feedRemoteURL = ctx.updateInfo.DownloadURL
+		}
+	}
+	if err != nil {
+		ctx.uploadStatus = stageFailed
+		return fmt.Errorf("%s", t("error.upload", err))
+	}
+	if dryRun {
+		ctx.uploadStatus = stagePlanned
+		return nil
+	}
+	ctx.uploadStatus = stageDone
+	logAndPrint(t("log.upload_completed"))
+	return nil
+}
+
+// saveRemoteUpdateInfo keeps the update info file the server serves before
+// the upload replaces it, so a rollback can put it back.
+func (ctx *releaseContext) saveRemoteUpdateInfo() {
+	data, found, err := fetchRemoteUpdateInfo(ctx.updateInfo.DownloadURL, filepath.Base(ctx.updateInfoPath))
+	if err != nil {
+		logVerbose(t("log.remote_feed_unavailable", err))
+		return
+	}
+	ctx.remoteFeed, ctx.remoteFeedSaved, ctx.remoteFeedMissing = data, found, !found
+}
+
+// gitRelease commits, tags and pushes the release if the plugin lives in a
+// GitHub repository.
+func (ctx *releaseContext) gitRelease() error {
+	pushed, err := handleGitHubIntegration(ctx.workDir, ctx.updateInfo, ctx.zipPath, ctx.opts.commitMessage)
+	switch {
+	case err != nil:
+		ctx.gitStatus = stageFailed
+		var committed *releaseCommittedError
+		ctx.releaseCommitted = errors.As(err, &committed)
+		return fmt.Errorf("%s", t("error.github_check", err))
+	case pushed && dryRun:
+		ctx.gitStatus = stagePlanned
+		ctx.gitTag = "v" + ctx.updateInfo.Version
+	case pushed:
+		ctx.gitStatus = stageDone
+		ctx.gitTag = "v" + ctx.updateInfo.Version
+		if output, err := runGitCommandOutput(ctx.workDir, "rev-parse", "HEAD"); err == nil {
+			ctx.gitCommit = strings.TrimSpace(string(output))
+		}
+	default:
+		ctx.gitStatus = stageSkipped
+	}
+	return nil
+}
+
+func runRelease(ctx *releaseContext) error {
+	// Block assets older than their sources stop the release before any file
+	// is changed.
+	if err := checkBlockAssets(ctx.workDir); err != nil {
+		return err
+	}
+	if err := ctx.syncVersion(); err != nil {
+		return err
+	}
+	ctx.updateChangelog()
+	ctx.syncUpgradeNotice()
+	ctx.syncReadme()
+	ctx.renderSections()
+	ctx.syncScreenshots()
+	ctx.convertSVGs()
+	if err := ctx.buildZip(); err != nil {
+		return err
+	}
+	if err := ctx.saveUpdateInfo(); err != nil {
+		return err
+	}
+	if !dryRun {
+		logAndPrint(t("log.zip_file_created", ctx.zipFileName))
+	}
+	if err := ctx.upload(); err != nil {
+		return err
+	}
+	if err := ctx.gitRelease(); err != nil {
+		return err
+	}
+	ctx.recordRelease()
+	return nil
+}
+
+func runBump(ctx *releaseContext) error {
+	if err := ctx.syncVersion(); err != nil {
+		return err
+	}
+	if ctx.opts.bumpLevel != "" {
+		if err := writeChangelogHeader(ctx.workDir, ctx.currentVersion); err != nil {
+			logAndPrint(t("error.changelog_write", err))
+		}
+	}
+	ctx.syncUpgradeNotice()
+	ctx.syncReadme()
+	ctx.renderSections()
+	ctx.syncScreenshots()
+	return ctx.saveUpdateInfo()
+}
+
+func runChangelog(ctx *releaseContext) error {
+	if err := ctx.detectVersion(); err != nil {
+		return err
+	}
+	ctx.updateChangelog()
+	if ctx.changelogText == "" {
+		return nil
+	}
+	ctx.syncUpgradeNotice()
+	ctx.syncReadme()
+	return ctx.saveUpdateInfo()
+}
+
+func runZip(ctx *releaseContext) error {
+	if err := checkBlockAssets(ctx.workDir); err != nil {
+		return err
+	}
+	if err := ctx.detectVersion(); err != nil {
+		return err
+	}
+	ctx.convertSVGs()
+	if err := ctx.buildZip(); err != nil {
+		return err
+	}
+	if err := ctx.saveUpdateInfo(); err != nil {
+		return err
+	}
+	if !dryRun {
+		logAndPrint(t("log.zip_file_created", ctx.zipFileName))
+	}
+	return nil
+}
+
+// runUpload uploads the ZIP that download_url in update_info.json points to.
+func runUpload(ctx *releaseContext) error {
+	ctx.zipFileName = filepath.Base(ctx.updateInfo.DownloadURL)
+	ctx.zipPath = filepath.Join(ctx.workDir, "Updates", ctx.zipFileName)
+	if _, err := os.Stat(ctx.zipPath); err != nil {
+		return fmt.Errorf("%s", t("error.zip_missing", ctx.zipPath))
+	}
+	return ctx.upload()
+}
+
+// runStatus prints the release state of the plugin without changing anything.
+func runStatus(ctx *releaseContext) error {
+	if err := ctx.detectVersion(); err != nil {
+		return err
+	}
+	logAndPrint(t("status.update_info_version", ctx.updateInfo.Version))
+	logAndPrint(t("status.download_url", redactSensitiveURL(ctx.updateInfo.DownloadURL)))
+
+	zipPath := filepath.Join(ctx.workDir, "Updates", filepath.Base(ctx.updateInfo.DownloadURL))
+	if fileExists(zipPath) {
+		logAndPrint(t("status.zip_present", filepath.Base(zipPath)))
+	} else {
+		logAndPrint(t("status.zip_missing", filepath.Base(zipPath)))
+	}
+
+	tagExists, err := checkGitTagExists(ctx.workDir, ctx.currentVersion)
+	if err != nil {
+		logAndPrint(t("error.git_tag_check", err))
+	} else if tagExists {
+		logAndPrint(t("status.git_tag_present", ctx.currentVersion))
+	} else {
+		logAndPrint(t("status.git_tag_missing", ctx.currentVersion))
+	}
+
+	changedFiles, err := getChangedFiles(ctx.workDir)
+	if err == nil {
+		logAndPrint(t("status.changed_files", len(changedFiles)))
+		for _, file := range changedFiles {
+			logVerbose("  " + file)
+		}
+	}
+
+	if ctx.updateInfo.Version != ctx.currentVersion {
+		logAndPrint(t("status.release_pending", ctx.currentVersion))
+	} else {
+		logAndPrint(t("status.up_to_date"))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pucCall is a buildUpdateChecker call of plugin-update-checker v4 or v5.
+// Positions are -1 for arguments that cannot be updated, e.g. a URL built
+// from an expression.
+type pucCall struct {
+	start, end         int
+	url, urlConstant   string
+	urlStart, urlEnd   int
+	slug               string
+	slugStart, slugEnd int
+}
+
+// findPUCCall finds the first X::buildUpdateChecker(url, file, slug) call,
+// e.g. on Puc_v4_Factory, the namespaced v5 PucFactory or an alias of it from
+// a use statement. Strings may use either quote; the file argument may be any
+// expression and the slug may be missing. A URL given as a constant is found
+// in its define() call in the same file. Calls in comments are ignored.
+func findPUCCall(content string) (pucCall, bool) {
+	tokens := lexPHP(content)
+	code := significantPHPTokens(tokens)
+	for i := 3; i+1 < len(code); i++ {
+		if code[i].kind != phpIdent || code[i].text != "buildUpdateChecker" || code[i+1].text != "(" ||
+			code[i-1].text != ":" || code[i-2].text != ":" || code[i-3].kind != phpIdent {
+			continue
+		}
+		args, end, ok := splitPHPArguments(code, i+1)
+		if !ok || len(args) < 2 {
+			continue
+		}
+		call := pucCall{start: code[i-3].start, end: end, urlStart: -1, urlEnd: -1, slugStart: -1, slugEnd: -1}
+
+		if len(args[0]) == 1 {
+			if value, start, end, ok := phpStringValue(args[0][0]); ok {
+				call.url, call.urlStart, call.urlEnd = value, start, end
+			} else if args[0][0].kind == phpIdent {
+				call.urlConstant = args[0][0].text
+				if value, start, end, ok := findStringDefine(code, call.urlConstant); ok {
+					call.url, call.urlStart, call.urlEnd = value, start, end
+				}
+			}
+		}
+		if len(args) >= 3 && len(args[2]) == 1 {
+			if value, start, end, ok := phpStringValue(args[2][0]); ok {
+				call.slug, call.slugStart, call.slugEnd = value, start, end
+			}
+		}
+		return call, true
+	}
+	return pucCall{}, false
+}
+
+// splitPHPArguments splits the arguments of the call whose "(" is code[open]
+// at the top level commas. It returns the end of the closing ")".
+func splitPHPArguments(code []phpToken, open int) ([][]phpToken, int, bool) {
+	var args [][]phpToken
+	var current []phpToken
+	depth := 0
+	for i := open + 1; i < len(code); i++ {
+		switch code[i].text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			if depth == 0 {
+				if len(current) > 0 {
+					args = append(args, current)
+				}
+				return args, code[i].end, code[i].text == ")"
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				args = append(args, current)
+				current = nil
+				continue
+			}
+		}
+		current = append(current, code[i])
+	}
+	return nil, 0, false
+}
+
+// findStringDefine returns the string value of define('name', '...').
+func findStringDefine(code []phpToken, name string) (string, int, int, bool) {
+	for i := 0; i+5 < len(code); i++ {
+		if code[i].kind != phpIdent || !strings.EqualFold(code[i].text, "define") || code[i+1].text != "(" {
+			continue
+		}
+		if key, _, _, ok := phpStringValue(code[i+2]); !ok || key != name || code[i+3].text != "," || code[i+5].text != ")" {
+			continue
+		}
+		return phpStringValue(code[i+4])
+	}
+	return "", 0, 0, false
+}
+
+// pucEnabled reports whether the plugin uses plugin-update-checker. It is
+// only disabled with "puc": false, e.g. for plugins hosted on WordPress.org.
+func (c *ConfigType) pucEnabled() bool {
+	return c.PUC == nil || *c.PUC
+}
+
+// pucFile returns the file with the buildUpdateChecker call, which is the
+// main PHP file, or functions.php for a theme, unless puc_file is set.
+func (c *ConfigType) pucFile() string {
+	if c.PUCFile != "" {
+		return c.PUCFile
+	}
+	if c.isTheme() {
+		return "functions.php"
+	}
+	return c.MainPHPFile
+}
+
+// syncPUCCall points the buildUpdateChecker call in pucFile to the update
+// info file updateInfoFile next to the download URL and sets its slug.
+func syncPUCCall(workDir, pucFile string, updateInfo *UpdateInfo, updateInfoFile string) error {
+	path, err := safeJoinWithinBase(workDir, pucFile)
+	if err != nil {
+		return err
+	}
+	logOpenedFile(path)
+	content, err := readReleaseFile(path)
+	if err != nil {
+		return fmt.Errorf("%s", t("error.php_read_file", err))
+	}
+	contentStr := string(content)
+
+	call, ok := findPUCCall(contentStr)
+	if !ok {
+		return fmt.Errorf("%s", t("error.no_valid_puc", path))
+	}
+	logVerbose(t("log.puc_download_url", redactSensitiveURL(call.url)))
+	logVerbose(t("log.puc_slug", call.slug))
+
+	type replacement struct {
+		start, end int
+		value      string
+	}
+	var replacements []replacement
+	newDownloadURL := strings.Replace(updateInfo.DownloadURL, filepath.Base(updateInfo.DownloadURL), updateInfoFile, 1)
+	switch {
+	case call.urlStart < 0 && call.urlConstant != "":
+		logAndPrint(t("log.puc_url_constant", call.urlConstant))
+	case call.urlStart < 0:
+		logAndPrint(t("log.puc_url_expression", pucFile))
+	case call.url != newDownloadURL:
+		replacements = append(replacements, replacement{call.urlStart, call.urlEnd, newDownloadURL})
+	}
+	if call.slugStart >= 0 && updateInfo.Slug != "" && call.slug != updateInfo.Slug {
+		replacements = append(replacements, replacement{call.slugStart, call.slugEnd, updateInfo.Slug})
+	}
+	if len(replacements) == 0 {
+		return nil
+	}
+
+	// The URL may be defined before or after the call, replace from the end.
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start > replacements[j].start })
+	for _, r := range replacements {
+		contentStr = contentStr[:r.start] + r.value + contentStr[r.end:]
+	}
+	if changed, ok := findPUCCall(contentStr); ok {
+		logVerbose(t("log.puc_changed", contentStr[changed.start:changed.end]))
+	}
+	if err := writeReleaseFile(path, []byte(contentStr), 0600); err != nil {
+		return fmt.Errorf(t("error.write_php"), err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// findReadmeTxt returns the path of the WordPress.org readme.txt of the plugin
+// or "" if there is none. The name is matched case-insensitively.
+func findReadmeTxt(workDir string) string {
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(entry.Name(), "readme.txt") {
+			return filepath.Join(workDir, entry.Name())
+		}
+	}
+	return ""
+}
+
+// syncReadmeTxt updates the header fields of readme.txt from the version and
+// update_info.json and, if changelogText is given, the entry of the version in
+// its == Changelog == section. Plugins without readme.txt are left alone.
+func syncReadmeTxt(workDir string, version string, updateInfo *UpdateInfo, changelogText string) error {
+	readmePath := findReadmeTxt(workDir)
+	if readmePath == "" {
+		logVerbose(t("log.readme_not_found"))
+		return nil
+	}
+	logOpenedFile(readmePath)
+	data, err := readReleaseFile(readmePath)
+	if err != nil {
+		return err
+	}
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	content = setReadmeHeaderFields(content, [][2]string{
+		{"Requires at least", updateInfo.RequiresWP},
+		{"Tested up to", updateInfo.TestedWP},
+		{"Requires PHP", updateInfo.RequiresPHP},
+		{"Stable tag", version},
+	})
+	if changelogText != "" {
+		content = setReadmeChangelogEntry(content, version, changelogText)
+	}
+
+	if content == strings.ReplaceAll(string(data), "\r\n", "\n") {
+		logVerbose(t("log.readme_unchanged", filepath.Base(readmePath)))
+		return nil
+	}
+	if err := writeReleaseFile(readmePath, []byte(content), 0644); err != nil {
+		return err
+	}
+	logAndPrint(t("log.readme_updated", filepath.Base(readmePath), version))
+	return nil
+}
+
+// setReadmeHeaderFields sets "Name: value" lines in the header, which ends at
+// the first "== Section ==". Missing fields are appended to the header fields;
+// empty values leave the field as it is.
+func setReadmeHeaderFields(content string, fields [][2]string) string {
+	headerEnd := len(content)
+	if m := regexp.MustCompile(`(?m)^==[^=].*==[ \t]*$`).FindStringIndex(content); m != nil {
+		headerEnd = m[0]
+	}
+	header, rest := content[:headerEnd], content[headerEnd:]
+
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		re := regexp.MustCompile(`(?mi)^(` + regexp.QuoteMeta(field[0]) + `:[ \t]*)(.*?)[ \t]*$`)
+		if re.MatchString(header) {
+			header = re.ReplaceAllString(header, "${1}"+strings.ReplaceAll(field[1], "$", "$$"))
+			continue
+		}
+		// Append after the last "Name: value" line of the header block.
+		lines := strings.Split(header, "\n")
+		last := -1
+		for i, l := range lines {
+			if regexp.MustCompile(`^[A-Za-z][A-Za-z ]*:`).MatchString(l) {
+				last = i
+			}
+		}
+		if last < 0 {
+			continue
+		}
+		lines = append(lines[:last+1], append([]string{field[0] + ": " + field[1]}, lines[last+1:]...)...)
+		header = strings.Join(lines, "\n")
+	}
+	return header + rest
+}
+
+// setReadmeChangelogEntry writes "= version =" with the changelog text as the
+// first entry of the == Changelog == section, replacing an existing entry of
+// that version. Without a changelog section one is added at the end.
+func setReadmeChangelogEntry(content string, version string, changelogText string) string {
+	var entry strings.Builder
+	entry.WriteString("= " + version + " =\n")
+	for _, line := range strings.Split(normalizeChangelogBullets(changelogText), "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "- ") {
+			line = "* " + strings.TrimPrefix(trimmed, "- ")
+		}
+		entry.WriteString(line + "\n")
+	}
+	entry.WriteString("\n")
+
+	section := regexp.MustCompile(`(?mi)^==[ \t]*Changelog[ \t]*==[ \t]*\n`).FindStringIndex(content)
+	if section == nil {
+		return strings.TrimRight(content, "\n") + "\n\n== Changelog ==\n\n" + strings.TrimRight(entry.String(), "\n") + "\n"
+	}
+	bodyStart := section[1]
+	bodyEnd := len(content)
+	if m := regexp.MustCompile(`(?m)^==[^=].*==[ \t]*$`).FindStringIndex(content[bodyStart:]); m != nil {
+		bodyEnd = bodyStart + m[0]
+	}
+	body := content[bodyStart:bodyEnd]
+
+	entryRegex := regexp.MustCompile(`(?m)^=[ \t]*v?` + regexp.QuoteMeta(version) + `(?:[ \t]+[^=\n]*)?[ \t]*=[ \t]*$`)
+	if m := entryRegex.FindStringIndex(body); m != nil {
+		end := len(body)
+		if next := regexp.MustCompile(`(?m)^=[^=].*=[ \t]*$`).FindStringIndex(body[m[1]:]); next != nil {
+			end = m[1] + next[0]
+		}
+		body = body[:m[0]] + entry.String() + body[end:]
+	} else {
+		lead := len(body) - len(strings.TrimLeft(body, "\n"))
+		body = body[:lead] + entry.String() + body[lead:]
+	}
+	if lead := len(body) - len(strings.TrimLeft(body, "\n")); lead == 0 {
+		body = "\n" + body
+	}
+	if bodyEnd < len(content) {
+		body = strings.TrimRight(body, "\n") + "\n\n"
+	} else {
+		body = strings.TrimRight(body, "\n") + "\n"
+	}
+	return content[:bodyStart] + body + content[bodyEnd:]
+}
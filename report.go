@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// releaseReport is the machine readable result of a command, written with
+// -json or -report. Unlike the console output it is not translated, and its
+// field names are kept stable for scripts.
+type releaseReport struct {
+	Plugin           string            `json:"plugin"`
+	Directory        string            `json:"directory"`
+	Command          string            `json:"command"`
+	Channel          string            `json:"channel,omitempty"`
+	DryRun           bool              `json:"dry_run"`
+	Success          bool              `json:"success"`
+	Error            string            `json:"error,omitempty"`
+	RolledBack       bool              `json:"rolled_back,omitempty"`
+	PreviousVersion  string            `json:"previous_version,omitempty"`
+	DetectedVersions map[string]string `json:"detected_versions,omitempty"`
+	Version          string            `json:"version,omitempty"`
+	Changelog        string            `json:"changelog,omitempty"`
+	Zip              *zipReport        `json:"zip,omitempty"`
+	Upload           *uploadReport     `json:"upload,omitempty"`
+	Git              *gitReport        `json:"git,omitempty"`
+}
+
+type zipReport struct {
+	Path   string   `json:"path"`
+	Size   int64    `json:"size,omitempty"`
+	SHA256 string   `json:"sha256,omitempty"`
+	Files  []string `json:"files"`
+}
+
+type uploadReport struct {
+	Status string   `json:"status"`
+	Files  []string `json:"files,omitempty"`
+}
+
+type gitReport struct {
+	Status string `json:"status"`
+	Commit string `json:"commit,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+}
+
+// newFailedReport reports a plugin that failed before its pipeline started.
+func newFailedReport(workDir string, opts *cliOptions, err error) *releaseReport {
+	return &releaseReport{
+		Plugin:    filepath.Base(workDir),
+		Directory: workDir,
+		Command:   opts.command,
+		Channel:   opts.channel,
+		DryRun:    dryRun,
+		Error:     err.Error(),
+	}
+}
+
+// report collects the results of the stages that ran. err is the error the
+// command failed with, if any.
+func (ctx *releaseContext) report(err error) *releaseReport {
+	r := &releaseReport{
+		Plugin:           filepath.Base(ctx.workDir),
+		Directory:        ctx.workDir,
+		Command:          ctx.opts.command,
+		Channel:          ctx.opts.channel,
+		DryRun:           dryRun,
+		Success:          err == nil,
+		RolledBack:       ctx.rolledBack,
+		PreviousVersion:  ctx.previousVersion,
+		DetectedVersions: ctx.detectedVersions,
+		Version:          ctx.currentVersion,
+		Changelog:        ctx.changelogText,
+	}
+	if ctx.updateInfo.Slug != "" {
+		r.Plugin = ctx.updateInfo.Slug
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if ctx.zipPath != "" {
+		r.Zip = &zipReport{Path: ctx.zipPath, Files: ctx.zipFiles}
+		if r.Zip.Files == nil {
+			r.Zip.Files = []string{}
+		}
+		if !dryRun {
+			if size, sum, err := fileSHA256(ctx.zipPath); err == nil {
+				r.Zip.Size = size
+				r.Zip.SHA256 = sum
+			}
+		}
+	}
+	if ctx.uploadStatus != "" {
+		r.Upload = &uploadReport{Status: ctx.uploadStatus, Files: ctx.uploadedFiles}
+	}
+	if ctx.gitStatus != "" {
+		r.Git = &gitReport{Status: ctx.gitStatus, Commit: ctx.gitCommit, Tag: ctx.gitTag}
+	}
+	return r
+}
+
+func fileSHA256(path string) (int64, string, error) {
+	f, err := os.Open(path) // # nosec G304
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeReports prints the reports to stdout with -json and writes them to the
+// -report file. A workspace writes a list, a single plugin one object.
+func writeReports(opts *cliOptions, list bool, reports ...*releaseReport) error {
+	if !opts.jsonOutput && opts.reportFile == "" {
+		return nil
+	}
+	var v interface{} = reports
+	if !list && len(reports) == 1 {
+		v = reports[0]
+	}
+	data, err := marshalWithoutHTMLescaping(v)
+	if err != nil {
+		return err
+	}
+	if opts.jsonOutput {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+	}
+	if opts.reportFile != "" {
+		return os.WriteFile(opts.reportFile, data, 0644)
+	}
+	return nil
+}
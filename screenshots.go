@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var screenshotFileRegex = regexp.MustCompile(`(?i)^screenshot-(\d+)\.(png|jpe?g|gif)$`)
+
+// screenshotFile is an Updates/screenshot-N image.
+type screenshotFile struct {
+	number int
+	name   string
+}
+
+// findScreenshots returns the screenshot-N images in Updates ordered by N.
+// If several images share a number, the first name in sort order wins.
+func findScreenshots(workDir string) ([]screenshotFile, error) {
+	entries, err := os.ReadDir(filepath.Join(workDir, "Updates"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []screenshotFile
+	seen := map[int]bool{}
+	for _, entry := range entries {
+		m := screenshotFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		number, err := strconv.Atoi(m[1])
+		if err != nil || seen[number] {
+			continue
+		}
+		seen[number] = true
+		files = append(files, screenshotFile{number, entry.Name()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].number < files[j].number })
+	return files, nil
+}
+
+// screenshotCaptions returns the captions by screenshot number from
+// Updates/screenshots.json, a list or an object keyed by number, and the
+// numbered list of == Screenshots == in readme.txt. screenshots.json wins.
+func screenshotCaptions(workDir string) (map[int]string, error) {
+	captions := map[int]string{}
+	if readmePath := findReadmeTxt(workDir); readmePath != "" {
+		data, err := readReleaseFile(readmePath)
+		if err != nil {
+			return nil, err
+		}
+		if body, ok := readmeSections(string(data))["screenshots"]; ok {
+			item := regexp.MustCompile(`(?m)^[ \t]*(\d+)\.[ \t]+(.+?)[ \t]*$`)
+			for _, m := range item.FindAllStringSubmatch(body, -1) {
+				if number, err := strconv.Atoi(m[1]); err == nil {
+					captions[number] = m[2]
+				}
+			}
+		}
+	}
+
+	jsonPath := filepath.Join(workDir, "Updates", "screenshots.json")
+	if !releaseFileExists(jsonPath) {
+		return captions, nil
+	}
+	logOpenedFile(jsonPath)
+	data, err := readReleaseFile(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for i, caption := range list {
+			captions[i+1] = caption
+		}
+		return captions, nil
+	}
+	var byNumber map[string]string
+	if err := json.Unmarshal(data, &byNumber); err != nil {
+		return nil, fmt.Errorf("%s", t("error.screenshots_json", err))
+	}
+	for key, caption := range byNumber {
+		number, err := strconv.Atoi(strings.TrimPrefix(key, "screenshot-"))
+		if err != nil {
+			return nil, fmt.Errorf("%s", t("error.screenshots_json_key", key))
+		}
+		captions[number] = caption
+	}
+	return captions, nil
+}
+
+// syncScreenshots sets the screenshots of update_info.json to the images in
+// Updates, with URLs next to the ZIP in download_url. Without images the
+// screenshots are left as they are.
+func syncScreenshots(workDir string, updateInfo *UpdateInfo) error {
+	files, err := findScreenshots(workDir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	captions, err := screenshotCaptions(workDir)
+	if err != nil {
+		return err
+	}
+	baseURL := strings.TrimSuffix(updateInfo.DownloadURL, filepath.Base(updateInfo.DownloadURL))
+	screenshots := make([]map[string]string, 0, len(files))
+	for _, f := range files {
+		screenshot := map[string]string{"src": baseURL + f.name}
+		if caption := captions[f.number]; caption != "" {
+			screenshot["caption"] = caption
+		}
+		screenshots = append(screenshots, screenshot)
+	}
+	updateInfo.Screenshots = screenshots
+	logVerbose(t("log.screenshots_found", len(screenshots)))
+	return nil
+}
+
+// syncScreenshots fills the screenshots of update_info.json. Errors are only
+// logged.
+func (ctx *releaseContext) syncScreenshots() {
+	if err := syncScreenshots(ctx.workDir, ctx.updateInfo); err != nil {
+		logAndPrint(t("error.screenshots", err))
+	}
+}
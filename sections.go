@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// readmeSectionNames maps the == Section == headings of readme.txt to the
+// keys of update_info.json sections. The changelog comes from Changelog.md.
+var readmeSectionNames = map[string]string{
+	"description":                "description",
+	"installation":               "installation",
+	"frequently asked questions": "faq",
+	"faq":                        "faq",
+	"screenshots":                "screenshots",
+	"other notes":                "other_notes",
+}
+
+// sectionsDir returns the directory with the Markdown sections.
+func sectionsDir(workDir string) string {
+	return filepath.Join(workDir, "Updates", "sections")
+}
+
+// collectSections returns the HTML of the plugin details sections: every
+// Updates/sections/<name>.md, and the sections of readme.txt that have no
+// Markdown file.
+func collectSections(workDir string) (map[string]string, error) {
+	sections := map[string]string{}
+	if readmePath := findReadmeTxt(workDir); readmePath != "" {
+		data, err := readReleaseFile(readmePath)
+		if err != nil {
+			return nil, err
+		}
+		for name, body := range readmeSections(string(data)) {
+			sections[name] = markdownToHTML(body)
+		}
+	}
+
+	entries, err := os.ReadDir(sectionsDir(workDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".md") {
+			continue
+		}
+		path := filepath.Join(sectionsDir(workDir), entry.Name())
+		logOpenedFile(path)
+		data, err := readReleaseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		sections[name] = markdownToHTML(string(data))
+	}
+	return sections, nil
+}
+
+// readmeSections returns the Markdown of the known == Section == blocks of a
+// readme.txt. "= Title =" subheadings become level 4 headings, as on
+// WordPress.org.
+func readmeSections(content string) map[string]string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	headings := regexp.MustCompile(`(?m)^==[ \t]*([^=\n]+?)[ \t]*==[ \t]*$`).FindAllStringSubmatchIndex(content, -1)
+	subheading := regexp.MustCompile(`(?m)^=[ \t]*([^=\n]+?)[ \t]*=[ \t]*$`)
+	sections := map[string]string{}
+	for i, h := range headings {
+		name, ok := readmeSectionNames[strings.ToLower(content[h[2]:h[3]])]
+		if !ok {
+			continue
+		}
+		end := len(content)
+		if i+1 < len(headings) {
+			end = headings[i+1][0]
+		}
+		body := subheading.ReplaceAllString(content[h[1]:end], "#### $1")
+		if strings.TrimSpace(body) != "" {
+			sections[name] = body
+		}
+	}
+	return sections
+}
+
+// renderSections writes the Markdown sections into the sections of
+// update_info.json. Errors are only logged.
+func (ctx *releaseContext) renderSections() {
+	sections, err := collectSections(ctx.workDir)
+	if err != nil {
+		logAndPrint(t("error.sections_render", err))
+		return
+	}
+	if len(sections) == 0 {
+		return
+	}
+	if ctx.updateInfo.Sections == nil {
+		ctx.updateInfo.Sections = make(map[string]string)
+	}
+	names := make([]string, 0, len(sections))
+	for name, html := range sections {
+		ctx.updateInfo.Sections[name] = html
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	logVerbose(t("log.sections_rendered", strings.Join(names, ", ")))
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	sshcommands "github.com/janmz/ssh-commands"
 	"golang.org/x/crypto/ssh"
@@ -77,98 +82,257 @@ func resolveKnownHostsPath(config *ConfigType, workDir string) string {
 	return filepath.Join(home, ".ssh", "known_hosts")
 }
 
-func uploadFiles(config *ConfigType, zipPath, updateInfoPath string, workDir string, updateInfo *UpdateInfo, fetchHostKey bool) error {
+// sshConnection is an open connection to an update server. Uploads over one
+// connection are serialized by lock.
+type sshConnection struct {
+	lock     sync.Mutex
+	mkdirAll func(remotePath string) error
+	upload   func(localPath, remotePath string) error
+	close    func()
+}
+
+// sshClientPool keeps one connection per user, host and port, so releasing
+// several plugins to the same server connects only once. New connections are
+// opened by dial.
+type sshClientPool struct {
+	lock        sync.Mutex
+	connections map[string]*sshConnection
+	dial        func(opts *sshcommands.Opts, knownHosts sshcommands.KnownHostsOptions) (*sshConnection, error)
+}
+
+func newSSHClientPool() *sshClientPool {
+	return &sshClientPool{connections: make(map[string]*sshConnection), dial: dialSSHConnection}
+}
+
+func (p *sshClientPool) connect(opts *sshcommands.Opts, knownHosts sshcommands.KnownHostsOptions) (*sshConnection, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := fmt.Sprintf("%s@%s:%d", opts.User, opts.Host, opts.Port)
+	if conn, ok := p.connections[key]; ok {
+		logVerbose(t("log.ssh_reusing", key))
+		return conn, nil
+	}
+
+	logVerbose(t("log.ssh_connecting", fmt.Sprintf("%s:%d", opts.Host, opts.Port)))
+	conn, err := p.dial(opts, knownHosts)
+	if err != nil {
+		return nil, err
+	}
+	logVerbose(t("log.ssh_connected"))
+	p.connections[key] = conn
+	return conn, nil
+}
+
+// dialSSHConnection opens an SSH connection to the server of opts.
+func dialSSHConnection(opts *sshcommands.Opts, knownHosts sshcommands.KnownHostsOptions) (*sshConnection, error) {
+	log := sshLog{}
+	client, err := sshcommands.DialKnownHosts(opts, knownHosts, log)
+	if err != nil {
+		return nil, err
+	}
+	return &sshConnection{
+		mkdirAll: func(remotePath string) error {
+			return sshcommands.MkdirAllRemote(client, remotePath, log)
+		},
+		upload: func(localPath, remotePath string) error {
+			return sshcommands.UploadFileIfNewer(client, localPath, remotePath, log)
+		},
+		close: func() { client.Close() },
+	}, nil
+}
+
+// Close closes all connections of the pool.
+func (p *sshClientPool) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for key, conn := range p.connections {
+		conn.close()
+		delete(p.connections, key)
+	}
+}
+
+// uploadItem is a single local file that is copied to the update server.
+type uploadItem struct {
+	localPath  string
+	remotePath string
+	errKey     string
+}
+
+// uploadFiles copies the release files to the server. The connection is taken
+// from pool, or opened just for this upload if pool is nil. It returns the
+// files that were uploaded, also if a later file failed.
+func uploadFiles(config *ConfigType, zipPath, updateInfoPath string, workDir string, updateInfo *UpdateInfo, fetchHostKey bool, pool *sshClientPool) ([]uploadItem, error) {
 	logVerbose(t("log.ssh_upload_start"))
 
-	opts, err := configToSSHOpts(config)
+	remoteLocalPath, err := parseRemotePath(updateInfo.DownloadURL, config.SSHDirBase)
+	if err != nil {
+		return nil, err
+	}
+	logVerbose(t("log.remote_path", remoteLocalPath))
+
+	items := collectUploadItems(zipPath, updateInfoPath, workDir, remoteLocalPath, updateInfo)
+	uploaded, err := transferFiles(config, workDir, remoteLocalPath, items, fetchHostKey, pool)
+	return items[:uploaded], err
+}
+
+// remoteUpdateInfoTimeout limits the download of the served update info file.
+const remoteUpdateInfoTimeout = 15 * time.Second
+
+// fetchRemoteUpdateInfo downloads the update info file the server serves next
+// to downloadURL, so a rollback can upload exactly that copy again. found is
+// false if the server has no such file yet.
+func fetchRemoteUpdateInfo(downloadURL string, name string) (data []byte, found bool, err error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return nil, false, err
+	}
+	u.Path = path.Join(path.Dir(u.Path), name)
+	u.RawQuery, u.Fragment = "", ""
+	client := &http.Client{Timeout: remoteUpdateInfoTimeout}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("%s: %s", redactSensitiveURL(u.String()), resp.Status)
+	}
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// restoreRemoteUpdateInfo uploads data as the update info file name next to
+// downloadURL, to put back the copy the server had before the release.
+func restoreRemoteUpdateInfo(config *ConfigType, data []byte, name string, workDir string, downloadURL string, fetchHostKey bool, pool *sshClientPool) error {
+	remoteLocalPath, err := parseRemotePath(downloadURL, config.SSHDirBase)
+	if err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp("", "wp_plugin_release")
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(tmpDir)
+	localPath := filepath.Join(tmpDir, name)
+	if err := os.WriteFile(localPath, data, 0600); err != nil {
+		return err
+	}
+	items := []uploadItem{
+		{localPath, filepath.Join(remoteLocalPath, name), "error.update_info_upload"},
+	}
+	_, err = transferFiles(config, workDir, remoteLocalPath, items, fetchHostKey, pool)
+	return err
+}
+
+// transferFiles uploads items in order into remoteLocalPath and returns how
+// many of them were uploaded.
+func transferFiles(config *ConfigType, workDir string, remoteLocalPath string, items []uploadItem, fetchHostKey bool, pool *sshClientPool) (int, error) {
+	opts, err := configToSSHOpts(config)
+	if err != nil {
+		return 0, err
+	}
 
 	knownHostsPath := resolveKnownHostsPath(config, workDir)
 	if knownHostsPath == "" {
-		return fmt.Errorf("%s", t("error.ssh_known_hosts_path"))
+		return 0, fmt.Errorf("%s", t("error.ssh_known_hosts_path"))
 	}
 
-	port := opts.Port
-	if port <= 0 {
-		port = 22
+	if dryRun {
+		port := opts.Port
+		if port <= 0 {
+			port = 22
+		}
+		addr := fmt.Sprintf("%s:%d", opts.Host, port)
+		for _, item := range items {
+			logAndPrint(t("dryrun.upload_file", item.localPath, addr+":"+item.remotePath))
+		}
+		return 0, nil
 	}
-	addr := fmt.Sprintf("%s:%d", opts.Host, port)
-	logVerbose(t("log.ssh_connecting", addr))
 
-	log := sshLog{}
-	client, err := sshcommands.DialKnownHosts(opts, sshcommands.KnownHostsOptions{
+	if pool == nil {
+		pool = newSSHClientPool()
+		defer pool.Close()
+	}
+	conn, err := pool.connect(opts, sshcommands.KnownHostsOptions{
 		Path:            knownHostsPath,
 		FetchHostKey:    fetchHostKey,
 		TrustOnMismatch: fetchHostKey,
-	}, log)
+	})
 	if err != nil {
 		if !fetchHostKey && strings.Contains(err.Error(), "not found") {
-			return fmt.Errorf("%s", t("error.ssh_host_key_required"))
+			return 0, fmt.Errorf("%s", t("error.ssh_host_key_required"))
 		}
-		return fmt.Errorf(t("error.ssh_connection"), err)
+		return 0, fmt.Errorf(t("error.ssh_connection"), err)
 	}
-	defer client.Close()
-	logVerbose(t("log.ssh_connected"))
 
-	remoteLocalPath, err := parseRemotePath(updateInfo.DownloadURL, config.SSHDirBase)
-	if err != nil {
-		return err
-	}
-	logVerbose(t("log.remote_path", remoteLocalPath))
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
 
-	if err := sshcommands.MkdirAllRemote(client, remoteLocalPath, log); err != nil {
+	if err := conn.mkdirAll(remoteLocalPath); err != nil {
 		logVerbose(t("log.remote_dir_warning", err))
 	}
 
-	if err := sshcommands.UploadFileIfNewer(client, zipPath, filepath.Join(remoteLocalPath, filepath.Base(zipPath)), log); err != nil {
-		return fmt.Errorf(t("error.zip_upload"), err)
+	for i, item := range items {
+		if err := conn.upload(item.localPath, item.remotePath); err != nil {
+			return i, fmt.Errorf(t(item.errKey), err)
+		}
 	}
+	return len(items), nil
+}
 
-	if err := sshcommands.UploadFileIfNewer(client, updateInfoPath, filepath.Join(remoteLocalPath, "update_info.json"), log); err != nil {
-		return fmt.Errorf(t("error.update_info_upload"), err)
+// collectUploadItems lists the ZIP, the update info file of the channel and
+// all banners, icons and screenshots it references that exist locally in
+// Updates.
+func collectUploadItems(zipPath, updateInfoPath, workDir, remoteLocalPath string, updateInfo *UpdateInfo) []uploadItem {
+	items := []uploadItem{
+		{zipPath, filepath.Join(remoteLocalPath, filepath.Base(zipPath)), "error.zip_upload"},
+		{updateInfoPath, filepath.Join(remoteLocalPath, filepath.Base(updateInfoPath)), "error.update_info_upload"},
 	}
 
 	updatePath := filepath.Join(workDir, "Updates")
-	if len(updateInfo.Banners) > 0 {
-		for key, bannerURL := range updateInfo.Banners {
-			if _, err := url.Parse(bannerURL); err == nil {
-				bannerFilename := filepath.Base(bannerURL)
-				localBannerPath := filepath.Join(updatePath, bannerFilename)
-				if _, err := os.Stat(localBannerPath); os.IsNotExist(err) {
-					logVerbose(t("log.banner_not_found", key, localBannerPath))
-				} else {
-					remoteBannerPath := filepath.Join(remoteLocalPath, bannerFilename)
-					if err := sshcommands.UploadFileIfNewer(client, localBannerPath, remoteBannerPath, log); err != nil {
-						return fmt.Errorf(t("error.banner_upload"), err)
-					}
-				}
+	for key, bannerURL := range updateInfo.Banners {
+		if _, err := url.Parse(bannerURL); err == nil {
+			bannerFilename := filepath.Base(bannerURL)
+			localBannerPath := filepath.Join(updatePath, bannerFilename)
+			if _, err := os.Stat(localBannerPath); os.IsNotExist(err) {
+				logVerbose(t("log.banner_not_found", key, localBannerPath))
 			} else {
-				logVerbose(t("log.banner_no_url", key, redactSensitiveURL(bannerURL)))
+				items = append(items, uploadItem{localBannerPath, filepath.Join(remoteLocalPath, bannerFilename), "error.banner_upload"})
 			}
+		} else {
+			logVerbose(t("log.banner_no_url", key, redactSensitiveURL(bannerURL)))
 		}
 	}
-	if len(updateInfo.Icons) > 0 {
-		for key, iconURL := range updateInfo.Icons {
-			if _, err := url.Parse(iconURL); err == nil {
-				iconFilename := filepath.Base(iconURL)
-				localIconPath := filepath.Join(updatePath, iconFilename)
-				if _, err := os.Stat(localIconPath); os.IsNotExist(err) {
-					logVerbose(t("log.icon_not_found", key, localIconPath))
-				} else {
-					remoteIconPath := filepath.Join(remoteLocalPath, iconFilename)
-					if err := sshcommands.UploadFileIfNewer(client, localIconPath, remoteIconPath, log); err != nil {
-						return fmt.Errorf(t("error.icon_upload"), err)
-					}
-				}
+	for key, iconURL := range updateInfo.Icons {
+		if _, err := url.Parse(iconURL); err == nil {
+			iconFilename := filepath.Base(iconURL)
+			localIconPath := filepath.Join(updatePath, iconFilename)
+			if _, err := os.Stat(localIconPath); os.IsNotExist(err) {
+				logVerbose(t("log.icon_not_found", key, localIconPath))
 			} else {
-				logVerbose(t("log.icon_no_url", key, redactSensitiveURL(iconURL)))
+				items = append(items, uploadItem{localIconPath, filepath.Join(remoteLocalPath, iconFilename), "error.icon_upload"})
 			}
+		} else {
+			logVerbose(t("log.icon_no_url", key, redactSensitiveURL(iconURL)))
 		}
 	}
-
-	return nil
+	for _, screenshot := range updateInfo.Screenshots {
+		screenshotFilename := filepath.Base(screenshot["src"])
+		localScreenshotPath := filepath.Join(updatePath, screenshotFilename)
+		if screenshotFileRegex.MatchString(screenshotFilename) && fileExists(localScreenshotPath) {
+			items = append(items, uploadItem{localScreenshotPath, filepath.Join(remoteLocalPath, screenshotFilename), "error.screenshot_upload"})
+		} else {
+			logVerbose(t("log.screenshot_not_found", localScreenshotPath))
+		}
+	}
+	return items
 }
 
 func parseRemotePath(downloadURL string, basedir string) (string, error) {
@@ -183,7 +183,7 @@ func convertSingleSVGHeight1024WithImageMagick(svgPath string, outputDir string)
 	}
 
 	// Height-only resize: keep aspect ratio, auto width.
-	if err := runSystemCommand("", *execPath, "-background", "transparent", "-resize", "x1024", svgPath, outputPath); err != nil {
+	if err := runConverter(outputPath, *execPath, "-background", "transparent", "-resize", "x1024", svgPath, outputPath); err != nil {
 		return fmt.Errorf("failed to convert %s: %v", svgPath, err)
 	}
 
@@ -203,7 +203,7 @@ func convertSingleSVGHeight1024WithInkscape(svgPath string, outputDir string) er
 	}
 
 	// Specify only height to preserve aspect ratio.
-	if err := runSystemCommand("", *execPath, "--export-filename", outputPath, "--export-height", "1024", svgPath); err != nil {
+	if err := runConverter(outputPath, *execPath, "--export-filename", outputPath, "--export-height", "1024", svgPath); err != nil {
 		return fmt.Errorf("failed to convert %s: %v", svgPath, err)
 	}
 
@@ -233,7 +233,7 @@ func convertSingleSVGWithImageMagick(svgPath string, outputDir string, squareSiz
 		return fmt.Errorf("magick executable not found")
 	}
 
-	if err := runSystemCommand("", *execPath, "-background", "transparent", "-resize", resizeArg, svgPath, outputPath); err != nil {
+	if err := runConverter(outputPath, *execPath, "-background", "transparent", "-resize", resizeArg, svgPath, outputPath); err != nil {
 		return fmt.Errorf("failed to convert %s: %v", svgPath, err)
 	}
 
@@ -265,7 +265,7 @@ func convertSingleSVGWithInkscape(svgPath string, outputDir string, squareSize [
 		return fmt.Errorf("inkscape executable not found")
 	}
 
-	if err := runSystemCommand("", *execPath, "--export-filename", outputPath, "--export-width", width, "--export-height", height, svgPath); err != nil {
+	if err := runConverter(outputPath, *execPath, "--export-filename", outputPath, "--export-width", width, "--export-height", height, svgPath); err != nil {
 		return fmt.Errorf("failed to convert %s: %v", svgPath, err)
 	}
 
@@ -273,6 +273,15 @@ func convertSingleSVGWithInkscape(svgPath string, outputDir string, squareSize [
 	return nil
 }
 
+// runConverter runs a converter that writes outputPath. The previous state of
+// the PNG is saved in the journal first, so a rollback restores it.
+func runConverter(outputPath string, execPath string, args ...string) error {
+	if err := recordReleaseFile(outputPath); err != nil {
+		return err
+	}
+	return runSystemCommand("", execPath, args...)
+}
+
 func uniqueStrings(items []string) []string {
 	seen := make(map[string]struct{}, len(items))
 	var out []string
@@ -412,6 +421,15 @@ func processSVGFiles(workDir string) error {
 		}
 	}
 
+	if dryRun {
+		for _, svgFile := range svgFilesToConvert {
+			for _, p := range expectedPNGPathsForSVG(updatesDir, svgFile) {
+				logAndPrint(t("dryrun.svg_convert", svgFile, filepath.Base(p)))
+			}
+		}
+		return nil
+	}
+
 	if err := convertSVGToPNG(updatesDir, svgFilesToConvert); err != nil {
 		return err
 	}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Release types of update.config. A theme keeps its version in the header of
+// style.css and its PUC bootstrap in functions.php.
+const (
+	releaseTypePlugin = "plugin"
+	releaseTypeTheme  = "theme"
+)
+
+func (c *ConfigType) isTheme() bool {
+	return c.Type == releaseTypeTheme
+}
+
+// validateType checks the type of update.config.
+func (c *ConfigType) validateType() error {
+	switch c.Type {
+	case "", releaseTypePlugin, releaseTypeTheme:
+		return nil
+	}
+	return fmt.Errorf("%s", t("error.config_type", c.Type))
+}
+
+// mainFile returns the file holding the header and version: main_php_file,
+// or style.css for a theme that does not set it.
+func (c *ConfigType) mainFile() string {
+	if c.MainPHPFile == "" && c.isTheme() {
+		return "style.css"
+	}
+	return c.MainPHPFile
+}
+
+// themeSlug returns the slug of the theme in workDir, which WordPress takes
+// from the name of the theme directory.
+func themeSlug(workDir string) string {
+	if abs, err := filepath.Abs(workDir); err == nil {
+		workDir = abs
+	}
+	return filepath.Base(workDir)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimestampFormat is the layout of last_updated and Last-Update.
+const defaultTimestampFormat = "2006-01-02 15:04:05"
+
+// releaseTime returns the time of the release: SOURCE_DATE_EPOCH if set, so
+// that reproducible builds write identical timestamps, otherwise now.
+func releaseTime() (time.Time, error) {
+	epoch := strings.TrimSpace(os.Getenv("SOURCE_DATE_EPOCH"))
+	if epoch == "" {
+		return time.Now(), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s", t("error.source_date_epoch", epoch))
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// releaseTimestamp formats the release time for last_updated and Last-Update
+// in the timezone (UTC by default, "Local" for the local time) and layout of
+// update.config.
+func (c *ConfigType) releaseTimestamp() (string, error) {
+	timezone := c.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return "", fmt.Errorf("%s", t("error.config_timezone", timezone, err))
+	}
+	layout := c.TimestampFormat
+	if layout == "" {
+		layout = defaultTimestampFormat
+	}
+	now, err := releaseTime()
+	if err != nil {
+		return "", err
+	}
+	return now.In(location).Format(layout), nil
+}
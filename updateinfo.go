@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// updateInfoFields returns the JSON keys modelled by UpdateInfo.
+func updateInfoFields() map[string]bool {
+	fields := map[string]bool{}
+	typ := reflect.TypeOf(UpdateInfo{})
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// UnmarshalJSON reads the modelled fields and keeps every other top level
+// field in Extra, e.g. custom PUC extensions of the feed. Custom sub-keys of
+// string maps such as banners that hold other values are skipped here; they
+// are kept by keepSkippedSubKeys in setUpdateInfo.
+func (u *UpdateInfo) UnmarshalJSON(data []byte) error {
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	typ := reflect.TypeOf(UpdateInfo{})
+	modelled := map[string]interface{}{}
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		value, ok := all[name]
+		if !ok {
+			continue
+		}
+		if object, isObject := value.(map[string]interface{}); isObject && typ.Field(i).Type == reflect.TypeOf(map[string]string{}) {
+			stringValues := map[string]interface{}{}
+			for key, sub := range object {
+				if _, isString := sub.(string); isString {
+					stringValues[key] = sub
+				}
+			}
+			value = stringValues
+		}
+		modelled[name] = value
+	}
+	modelledData, err := json.Marshal(modelled)
+	if err != nil {
+		return err
+	}
+	type plainUpdateInfo UpdateInfo
+	if err := json.Unmarshal(modelledData, (*plainUpdateInfo)(u)); err != nil {
+		return err
+	}
+
+	fields := updateInfoFields()
+	u.Extra = map[string]interface{}{}
+	for key, value := range all {
+		if !fields[key] {
+			u.Extra[key] = value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes the modelled fields and the fields of Extra. A field of
+// Extra never overrides a modelled one.
+func (u UpdateInfo) MarshalJSON() ([]byte, error) {
+	type plainUpdateInfo UpdateInfo
+	data, err := marshalWithoutHTMLescaping(plainUpdateInfo(u))
+	if err != nil || len(u.Extra) == 0 {
+		return data, err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	fields := updateInfoFields()
+	for key, value := range u.Extra {
+		if !fields[key] {
+			all[key] = value
+		}
+	}
+	return marshalWithoutHTMLescaping(all)
+}
+
+// stringMapFields returns the JSON keys of UpdateInfo fields that are string
+// maps, such as sections and banners.
+func stringMapFields() map[string]bool {
+	fields := map[string]bool{}
+	typ := reflect.TypeOf(UpdateInfo{})
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Type == reflect.TypeOf(map[string]string{}) {
+			name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// keepSkippedSubKeys returns value, the new value of a string map field, with
+// the sub-keys of base that hold no string. UnmarshalJSON skipped those, so
+// they are not part of value; every other sub-key of base is dropped.
+func keepSkippedSubKeys(base, value interface{}) interface{} {
+	baseObject, baseIsObject := base.(map[string]interface{})
+	valueObject, valueIsObject := value.(map[string]interface{})
+	if !baseIsObject || !valueIsObject {
+		return value
+	}
+	for key, sub := range baseObject {
+		if _, isString := sub.(string); !isString {
+			if _, ok := valueObject[key]; !ok {
+				valueObject[key] = sub
+			}
+		}
+	}
+	return valueObject
+}
+
+// mergeJSONValues merges overlay into base: objects are merged key by key at
+// every level, so sub-keys only base knows survive, any other value of
+// overlay replaces the one of base.
+func mergeJSONValues(base, overlay interface{}) interface{} {
+	baseObject, baseIsObject := base.(map[string]interface{})
+	overlayObject, overlayIsObject := overlay.(map[string]interface{})
+	if !baseIsObject || !overlayIsObject {
+		return overlay
+	}
+	merged := make(map[string]interface{}, len(baseObject)+len(overlayObject))
+	for key, value := range baseObject {
+		merged[key] = value
+	}
+	for key, value := range overlayObject {
+		merged[key] = mergeJSONValues(baseObject[key], value)
+	}
+	return merged
+}
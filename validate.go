@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// updateInfoIssue is a field of update_info.json that plugin-update-checker
+// cannot use, with the line of the field. Syntax errors also have a column.
+type updateInfoIssue struct {
+	line    int
+	field   string
+	message string
+	column  int
+}
+
+var (
+	wpVersionRegex  = regexp.MustCompile(`^\d+\.\d+(\.\d+)?$`)
+	phpVersionRegex = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+	updateInfoURLs  = []string{"download_url", "homepage", "details_url", "author_homepage", "donate_link"}
+	updateInfoTexts = []string{"name", "slug", "author", "upgrade_notice", "last_updated", "added"}
+	updateInfoNums  = []string{"rating", "num_ratings", "downloaded", "active_installs"}
+	// updateInfoImageKeys are the sizes of banners and icons.
+	updateInfoImageKeys = map[string]bool{"low": true, "high": true, "1x": true, "2x": true, "svg": true, "default": true}
+)
+
+// validateUpdateInfoData checks update_info.json against the fields PUC
+// reads. version and download_url are required, name is required unless
+// details_url marks the theme format. Unknown fields are allowed.
+func validateUpdateInfoData(data []byte) []updateInfoIssue {
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line, column := jsonPosition(data, syntaxErr.Offset)
+			return []updateInfoIssue{{line, "", err.Error(), column}}
+		case errors.As(err, &typeErr):
+			return []updateInfoIssue{{jsonLine(data, typeErr.Offset), "", t("validate.object"), 0}}
+		}
+		return []updateInfoIssue{{1, "", err.Error(), 0}}
+	}
+
+	lines := jsonKeyLines(data)
+	var issues []updateInfoIssue
+	report := func(field, key string, args ...interface{}) {
+		issues = append(issues, updateInfoIssue{lines[field], field, t(key, args...), 0})
+	}
+
+	required := []string{"version", "download_url"}
+	if _, theme := all["details_url"]; !theme {
+		required = append(required, "name")
+	}
+	for _, field := range required {
+		v, present := all[field]
+		if _, isString := v.(string); present && !isString {
+			report(field, "validate.string")
+		} else if !present || strings.TrimSpace(v.(string)) == "" {
+			report(field, "validate.missing")
+		}
+	}
+	if s, ok := all["version"].(string); ok && s != "" && !regexp.MustCompile(`^`+versionPattern+`$`).MatchString(s) {
+		report("version", "validate.version", s)
+	}
+	for _, field := range updateInfoTexts {
+		if v, ok := all[field]; ok {
+			if _, ok := v.(string); !ok {
+				report(field, "validate.string")
+			}
+		}
+	}
+	for _, field := range updateInfoURLs {
+		if v, ok := all[field]; ok {
+			checkUpdateInfoURL(v, field, report)
+		}
+	}
+	for field, re := range map[string]*regexp.Regexp{"tested": wpVersionRegex, "requires": wpVersionRegex, "requires_php": phpVersionRegex} {
+		if v, ok := all[field]; ok {
+			if s, ok := v.(string); !ok || !re.MatchString(s) {
+				report(field, "validate.wp_version", fmt.Sprint(v))
+			}
+		}
+	}
+	for _, field := range updateInfoNums {
+		if v, ok := all[field]; ok {
+			if n, ok := v.(float64); !ok || n < 0 {
+				report(field, "validate.number")
+			}
+		}
+	}
+	for _, field := range []string{"sections", "contributors", "banners", "icons", "ratings"} {
+		v, ok := all[field]
+		if !ok {
+			continue
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			report(field, "validate.object")
+			continue
+		}
+		for key, value := range m {
+			sub := field + "." + key
+			switch field {
+			case "ratings":
+				if _, ok := value.(float64); !ok {
+					report(sub, "validate.number")
+				}
+			case "banners", "icons":
+				// Custom sub-keys are allowed, only the images PUC shows are checked.
+				if updateInfoImageKeys[key] {
+					checkUpdateInfoURL(value, sub, report)
+				}
+			default:
+				if _, ok := value.(string); !ok {
+					report(sub, "validate.string")
+				}
+			}
+		}
+	}
+	if v, ok := all["tags"]; ok {
+		checkStringCollection(v, "tags", report)
+	}
+	if v, ok := all["screenshots"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			report("screenshots", "validate.list")
+		}
+		for i, item := range list {
+			checkStringCollection(item, "screenshots."+strconv.Itoa(i), report)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].line != issues[j].line {
+			return issues[i].line < issues[j].line
+		}
+		return issues[i].field < issues[j].field
+	})
+	return issues
+}
+
+// checkUpdateInfoURL reports a value that is not an absolute http(s) URL.
+func checkUpdateInfoURL(v interface{}, field string, report func(string, string, ...interface{})) {
+	s, ok := v.(string)
+	if !ok {
+		report(field, "validate.string")
+		return
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		report(field, "validate.url", s)
+	}
+}
+
+// checkStringCollection reports a value that is neither a list nor an object
+// of strings.
+func checkStringCollection(v interface{}, field string, report func(string, string, ...interface{})) {
+	switch c := v.(type) {
+	case []interface{}:
+		for i, item := range c {
+			if _, ok := item.(string); !ok {
+				report(field+"."+strconv.Itoa(i), "validate.string")
+			}
+		}
+	case map[string]interface{}:
+		for key, item := range c {
+			if _, ok := item.(string); !ok {
+				report(field+"."+key, "validate.string")
+			}
+		}
+	default:
+		report(field, "validate.list")
+	}
+}
+
+// jsonKeyLines returns the line of every object key and array element of a
+// JSON document by its dotted path, e.g. "sections.changelog" or
+// "screenshots.0".
+func jsonKeyLines(data []byte) map[string]int {
+	type frame struct {
+		object    bool
+		expectKey bool
+		key       string
+		index     int
+	}
+	lines := map[string]int{}
+	var stack []*frame
+	path := func() string {
+		parts := make([]string, len(stack))
+		for i, f := range stack {
+			if f.object {
+				parts[i] = f.key
+			} else {
+				parts[i] = strconv.Itoa(f.index)
+			}
+		}
+		return strings.Join(parts, ".")
+	}
+	valueDone := func() {
+		if len(stack) == 0 {
+			return
+		}
+		if top := stack[len(stack)-1]; top.object {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return lines
+		}
+		if len(stack) > 0 && !stack[len(stack)-1].object {
+			if d, ok := tok.(json.Delim); !ok || (d != ']' && d != '}') {
+				lines[path()] = jsonLine(data, offset)
+			}
+		}
+		if d, ok := tok.(json.Delim); ok {
+			if d == '{' || d == '[' {
+				stack = append(stack, &frame{object: d == '{', expectKey: d == '{'})
+			} else {
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+			continue
+		}
+		if top := len(stack) - 1; top >= 0 && stack[top].object && stack[top].expectKey {
+			stack[top].key, _ = tok.(string)
+			stack[top].expectKey = false
+			lines[path()] = jsonLine(data, offset)
+			continue
+		}
+		valueDone()
+	}
+}
+
+// jsonLine returns the line of the token after offset in data, skipping the
+// whitespace and separators before it.
+func jsonLine(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n,:", rune(data[offset])) {
+		offset++
+	}
+	if offset > 0 && offset == int64(len(data)) {
+		offset--
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// jsonPosition returns the line and column of the character at which a
+// json.SyntaxError with offset was found.
+func jsonPosition(data []byte, offset int64) (int, int) {
+	pos := int(offset) - 1
+	if pos > len(data) {
+		pos = len(data)
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	lineStart := bytes.LastIndexByte(data[:pos], '\n') + 1
+	return bytes.Count(data[:pos], []byte("\n")) + 1, pos - lineStart + 1
+}
+
+// updateInfoValidationError combines the issues of the update info file at
+// path into one error with a line per issue.
+func updateInfoValidationError(path string, issues []updateInfoIssue) error {
+	var b strings.Builder
+	b.WriteString(t("error.update_info_invalid", filepath.Base(path), len(issues)))
+	for _, issue := range issues {
+		b.WriteString("\n  ")
+		b.WriteString(formatUpdateInfoIssue(path, issue))
+	}
+	return errors.New(b.String())
+}
+
+// formatUpdateInfoIssue formats an issue as file:line: field: message, or
+// file:line:column: message for a syntax error. A missing field has no line.
+func formatUpdateInfoIssue(path string, issue updateInfoIssue) string {
+	if issue.column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", filepath.Base(path), issue.line, issue.column, issue.message)
+	}
+	if issue.line == 0 {
+		return fmt.Sprintf("%s: %s: %s", filepath.Base(path), issue.field, issue.message)
+	}
+	if issue.field == "" {
+		return fmt.Sprintf("%s:%d: %s", filepath.Base(path), issue.line, issue.message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", filepath.Base(path), issue.line, issue.field, issue.message)
+}
+
+// runValidate checks the update info file of the selected channel without
+// writing anything, e.g. in CI before a release.
+func runValidate(ctx *releaseContext) error {
+	data, err := readReleaseFile(ctx.updateInfoPath)
+	if err != nil {
+		return fmt.Errorf("%s", t("error.update_info_read_file", err))
+	}
+	if issues := validateUpdateInfoData(data); len(issues) > 0 {
+		return updateInfoValidationError(ctx.updateInfoPath, issues)
+	}
+	logAndPrint(t("validate.valid", filepath.Base(ctx.updateInfoPath)))
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// versionSource is a place holding a version of the plugin, as reported by
+// the verify command.
+type versionSource struct {
+	name    string
+	version string
+}
+
+// collectVersionSources reads the version of every place that has one: the
+// main PHP file, the version locations, block.json files, update_info.json,
+// the latest Changelog.md section and the ZIP in download_url. Places without
+// a version are left out. Nothing is written.
+func collectVersionSources(workDir string, config *ConfigType, updateInfo *UpdateInfo) ([]versionSource, error) {
+	var sources []versionSource
+	add := func(name, version string) {
+		if version != "" {
+			sources = append(sources, versionSource{name, version})
+		}
+	}
+
+	versions, err := readPHPVersions(workDir, config.mainFile())
+	if err != nil {
+		return nil, err
+	}
+	add("header", versions.comment)
+	add("class", versions.class)
+	add("define", versions.define)
+
+	locations, err := readVersionLocations(workDir, config.VersionLocations)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range locations {
+		add(l.location.label(), l.version)
+	}
+
+	blocks, err := findBlockJSONFiles(workDir, config.SkipPattern)
+	if err != nil {
+		return nil, fmt.Errorf(t("error.walk_files"), err)
+	}
+	for _, relPath := range blocks {
+		content, err := readReleaseFile(filepath.Join(workDir, relPath))
+		if err != nil {
+			return nil, fmt.Errorf("%s", t("error.block_json_read", relPath, err))
+		}
+		if start, end, ok := findJSONStringValue(string(content), []string{"version"}); ok {
+			add(filepath.ToSlash(relPath), string(content[start:end]))
+		}
+	}
+
+	add("update_info", updateInfo.Version)
+	add("changelog", latestChangelogVersion(workDir))
+	zipVersion := regexp.MustCompile(`-v?(` + versionPattern + `)\.zip$`).FindStringSubmatch(filepath.Base(updateInfo.DownloadURL))
+	if zipVersion != nil {
+		add("download_url", zipVersion[1])
+	}
+	return sources, nil
+}
+
+// latestChangelogVersion returns the version of the first "## " section of
+// Changelog.md that has one, skipping e.g. "## [Unreleased]".
+func latestChangelogVersion(workDir string) string {
+	data, err := readReleaseFile(changelogPathForWorkDir(workDir))
+	if err != nil {
+		return ""
+	}
+	re := regexp.MustCompile(`(?m)^##\s*\[?v?(` + versionPattern + `)\]?(?:\s|$)`)
+	if m := re.FindStringSubmatch(string(data)); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// latestGitTagVersion returns the highest version tagged v<version>, or "".
+func latestGitTagVersion(workDir string) (string, error) {
+	if !fileExists(filepath.Join(workDir, ".git")) {
+		return "", nil
+	}
+	output, err := runGitCommandOutput(workDir, "tag", "-l", "v*")
+	if err != nil {
+		return "", err
+	}
+	tagRegex := regexp.MustCompile(`^v(` + versionPattern + `)$`)
+	latest := ""
+	for _, tag := range strings.Split(string(output), "\n") {
+		if m := tagRegex.FindStringSubmatch(strings.TrimSpace(tag)); m != nil {
+			latest = getHigherVersion(latest, m[1])
+		}
+	}
+	return latest, nil
+}
+
+// runVerify compares the version of every source with the plugin version and
+// fails on a mismatch. The git tag of the version may still be missing before
+// the release commit, but no tag may be newer than the version. Unlike the
+// other commands it never writes a file, so it can run as a pre-commit hook
+// or CI gate.
+func runVerify(ctx *releaseContext) error {
+	if err := ctx.detectVersion(); err != nil {
+		return err
+	}
+	sources, err := collectVersionSources(ctx.workDir, &ctx.config, ctx.updateInfo)
+	if err != nil {
+		return err
+	}
+
+	mismatches := 0
+	ctx.detectedVersions = map[string]string{}
+	for _, s := range sources {
+		ctx.detectedVersions[s.name] = s.version
+		if s.version == ctx.currentVersion {
+			logAndPrint(t("verify.match", s.name, s.version))
+		} else {
+			logAndPrint(t("verify.mismatch", s.name, s.version, ctx.currentVersion))
+			mismatches++
+		}
+	}
+
+	tagExists, err := checkGitTagExists(ctx.workDir, ctx.currentVersion)
+	if err != nil {
+		return fmt.Errorf("%s", t("error.git_tag_check", err))
+	}
+	latestTag, err := latestGitTagVersion(ctx.workDir)
+	if err != nil {
+		return fmt.Errorf("%s", t("error.git_tag_check", err))
+	}
+	switch {
+	case tagExists:
+		ctx.detectedVersions["git_tag"] = ctx.currentVersion
+		logAndPrint(t("verify.match", "git_tag", "v"+ctx.currentVersion))
+	case latestTag != "" && compareVersions(latestTag, ctx.currentVersion) > 0:
+		ctx.detectedVersions["git_tag"] = latestTag
+		logAndPrint(t("verify.tag_newer", "git_tag", "v"+latestTag, ctx.currentVersion))
+		mismatches++
+	case latestTag != "":
+		ctx.detectedVersions["git_tag"] = latestTag
+		logAndPrint(t("verify.tag_pending", "git_tag", "v"+latestTag, ctx.currentVersion))
+	}
+
+	if mismatches > 0 {
+		return fmt.Errorf("%s", t("error.verify_mismatch", mismatches, ctx.currentVersion))
+	}
+	logAndPrint(t("verify.consistent", ctx.currentVersion))
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// preReleasePattern matches an optional SemVer pre-release (-beta.2) and
+// build metadata (+20240101) suffix.
+const preReleasePattern = `(?:-[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?`
+
+// versionPattern matches plugin versions with two to four numeric parts
+// (major.minor[.patch[.build]]) and an optional pre-release and build suffix.
+const versionPattern = `[0-9]+\.[0-9]+(?:\.[0-9]+){0,2}` + preReleasePattern
+
+// zipVersionPattern matches the version suffix of a release ZIP name such as
+// -v1.2.0.zip or -v1.2.0-rc.1.zip.
+const zipVersionPattern = `-v?[0-9]+(?:\.[0-9]+)+` + preReleasePattern + `\.zip$`
+
+// parsedVersion is a version split into its numeric parts and the dot
+// separated pre-release identifiers. Build metadata is dropped because it
+// does not take part in the ordering.
+type parsedVersion struct {
+	numbers    []int
+	preRelease []string
+}
+
+func parseVersion(version string) parsedVersion {
+	var v parsedVersion
+	if i := strings.Index(version, "+"); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.Index(version, "-"); i >= 0 {
+		v.preRelease = strings.Split(version[i+1:], ".")
+		version = version[:i]
+	}
+	for _, p := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(p)
+		v.numbers = append(v.numbers, n)
+	}
+	return v
+}
+
+// compareVersions compares two versions following the SemVer precedence rules
+// and returns -1, 0 or 1. Missing numeric parts count as 0, so 1.2 equals
+// 1.2.0, and a pre-release is lower than the release it precedes.
+func compareVersions(v1, v2 string) int {
+	p1 := parseVersion(v1)
+	p2 := parseVersion(v2)
+
+	for i := 0; i < len(p1.numbers) || i < len(p2.numbers); i++ {
+		var n1, n2 int
+		if i < len(p1.numbers) {
+			n1 = p1.numbers[i]
+		}
+		if i < len(p2.numbers) {
+			n2 = p2.numbers[i]
+		}
+		if n1 != n2 {
+			return compareInts(n1, n2)
+		}
+	}
+
+	switch {
+	case len(p1.preRelease) == 0 && len(p2.preRelease) == 0:
+		return 0
+	case len(p1.preRelease) == 0:
+		return 1
+	case len(p2.preRelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(p1.preRelease) && i < len(p2.preRelease); i++ {
+		a, b := p1.preRelease[i], p2.preRelease[i]
+		if a == b {
+			continue
+		}
+		na, errA := strconv.Atoi(a)
+		nb, errB := strconv.Atoi(b)
+		switch {
+		case errA == nil && errB == nil:
+			return compareInts(na, nb)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		case a < b:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return compareInts(len(p1.preRelease), len(p2.preRelease))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// bumpLevels lists the version parts that can be incremented, in the order
+// of their position in the version.
+var bumpLevels = []string{"major", "minor", "patch", "build"}
+
+func isBumpLevel(level string) bool {
+	for _, l := range bumpLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// bumpVersion increments the given part of version and resets all parts
+// after it to 0. Missing parts up to the bumped one are added, so bumping the
+// build of 1.2 gives 1.2.0.1. A pre-release is released instead if all parts
+// after the bumped one are 0: the patch of 1.3.0-rc.1 gives 1.3.0.
+func bumpVersion(version string, level string) (string, error) {
+	index := -1
+	for i, l := range bumpLevels {
+		if l == level {
+			index = i
+		}
+	}
+	if index < 0 {
+		return "", fmt.Errorf("%s", t("error.bump_level", level))
+	}
+
+	if i := strings.Index(version, "+"); i >= 0 {
+		version = version[:i]
+	}
+	isPreRelease := false
+	if i := strings.Index(version, "-"); i >= 0 {
+		version = version[:i]
+		isPreRelease = true
+	}
+
+	parts := strings.Split(version, ".")
+	numbers := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return "", fmt.Errorf("%s", t("error.bump_version", version))
+		}
+		numbers[i] = n
+	}
+	for len(numbers) <= index {
+		numbers = append(numbers, 0)
+	}
+
+	releaseOnly := isPreRelease
+	for i := index + 1; i < len(numbers); i++ {
+		if numbers[i] != 0 {
+			releaseOnly = false
+		}
+	}
+	if !releaseOnly {
+		numbers[index]++
+		for i := index + 1; i < len(numbers); i++ {
+			numbers[i] = 0
+		}
+	}
+
+	out := make([]string, len(numbers))
+	for i, n := range numbers {
+		out[i] = strconv.Itoa(n)
+	}
+	return strings.Join(out, "."), nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// workspaceConfig is a workspace file listing plugin directories that are
+// released together, e.g.
+//
+//	{
+//	  "plugins": ["plugin-a", "../shop/plugin-b"],
+//	  "parallel": 2
+//	}
+//
+// Relative directories are resolved against the directory of the file.
+type workspaceConfig struct {
+	Plugins  []string `json:"plugins"`
+	Parallel int      `json:"parallel"`
+}
+
+// workspaceResult is one row of the summary printed after a workspace run.
+type workspaceResult struct {
+	dir        string
+	slug       string
+	oldVersion string
+	newVersion string
+	zipName    string
+	upload     string
+	git        string
+	err        error
+	report     *releaseReport
+}
+
+func loadWorkspace(path string) (*workspaceConfig, []string, error) {
+	data, err := os.ReadFile(path) // # nosec G304
+	if err != nil {
+		return nil, nil, err
+	}
+	var ws workspaceConfig
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, nil, err
+	}
+	if len(ws.Plugins) == 0 {
+		return nil, nil, fmt.Errorf("%s", t("error.workspace_empty", path))
+	}
+	baseDir := filepath.Dir(path)
+	dirs := make([]string, 0, len(ws.Plugins))
+	for _, dir := range ws.Plugins {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(baseDir, dir)
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return &ws, dirs, nil
+}
+
+// runWorkspace runs the selected command for every plugin of the workspace
+// and returns the exit code. All plugins share one SSH connection per server.
+// Plugins released in parallel cannot prompt and log into a common file next
+// to the workspace file, otherwise each plugin logs into its own update.log.
+func runWorkspace(opts *cliOptions) int {
+	ws, dirs, err := loadWorkspace(opts.workspace)
+	if err != nil {
+		fmt.Fprintf(console, "%s", t("error.workspace_read", err)+"\n")
+		return 1
+	}
+	parallel := ws.Parallel
+	if opts.parallel > 0 {
+		parallel = opts.parallel
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	if parallel > len(dirs) {
+		parallel = len(dirs)
+	}
+
+	initLogFile(strings.TrimSuffix(opts.workspace, filepath.Ext(opts.workspace)) + ".log")
+	defer logFile.Close()
+	logRunModes()
+	logAndPrint(t("log.workspace_start", len(dirs), parallel))
+	if parallel > 1 {
+		nonInteractive = true
+	}
+
+	pool := newSSHClientPool()
+	defer pool.Close()
+
+	results := make([]workspaceResult, len(dirs))
+	if parallel == 1 {
+		for i, dir := range dirs {
+			results[i] = runWorkspacePlugin(dir, opts, pool, true)
+		}
+	} else {
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, parallel)
+		for i, dir := range dirs {
+			wg.Add(1)
+			go func(i int, dir string) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				results[i] = runWorkspacePlugin(dir, opts, pool, false)
+			}(i, dir)
+		}
+		wg.Wait()
+	}
+
+	printWorkspaceSummary(results, filepath.Dir(opts.workspace))
+	exitCode := 0
+	reports := make([]*releaseReport, len(results))
+	for i, result := range results {
+		reports[i] = result.report
+		if result.err != nil {
+			exitCode = 1
+		}
+	}
+	if err := writeReports(opts, true, reports...); err != nil {
+		logAndPrint(t("error.report_write", err))
+		exitCode = 1
+	}
+	return exitCode
+}
+
+// runWorkspacePlugin runs the command for the plugin in dir. With ownLog the
+// plugin's update.log is used while it runs.
+func runWorkspacePlugin(dir string, opts *cliOptions, pool *sshClientPool, ownLog bool) workspaceResult {
+	result := workspaceResult{dir: dir}
+
+	if _, err := os.Stat(filepath.Join(dir, "update.config")); err != nil {
+		result.err = fmt.Errorf("%s", t("error.no_config", dir))
+		result.report = newFailedReport(dir, opts, result.err)
+		logAndPrint(result.err.Error())
+		return result
+	}
+	if ownLog {
+		pluginLogFile, pluginLogger, err := openLogFile(filepath.Join(dir, "update.log"))
+		if err != nil {
+			result.err = fmt.Errorf("%s", t("error.log_file", err))
+			result.report = newFailedReport(dir, opts, result.err)
+			logAndPrint(result.err.Error())
+			return result
+		}
+		workspaceLogFile, workspaceLogger := logFile, logger
+		logFile, logger = pluginLogFile, pluginLogger
+		defer func() {
+			pluginLogFile.Close()
+			logFile, logger = workspaceLogFile, workspaceLogger
+		}()
+		logRunModes()
+	}
+	logAndPrint(t("log.workspace_plugin", dir))
+
+	pluginOpts := *opts
+	pluginOpts.workDir = dir
+	ctx, err := newReleaseContext(dir, &pluginOpts)
+	if err != nil {
+		result.err = err
+		result.report = newFailedReport(dir, opts, err)
+		logAndPrint(err.Error())
+		return result
+	}
+	ctx.sshPool = pool
+	result.oldVersion = ctx.previousVersion
+
+	err = ctx.runCommand(findCommand(opts.command))
+	result.slug = ctx.updateInfo.Slug
+	result.newVersion = ctx.currentVersion
+	result.zipName = ctx.zipFileName
+	result.upload = ctx.uploadStatus
+	result.git = ctx.gitStatus
+	result.report = ctx.report(err)
+	if err != nil {
+		result.err = err
+		logAndPrint(err.Error())
+		return result
+	}
+	logCommandCompleted(opts.command)
+	return result
+}
+
+// printWorkspaceSummary prints one table row per plugin followed by the
+// errors of failed plugins. Plugins are named relative to baseDir, the
+// directory of the workspace file.
+func printWorkspaceSummary(results []workspaceResult, baseDir string) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+		t("workspace.column.plugin"), t("workspace.column.old_version"), t("workspace.column.new_version"),
+		t("workspace.column.zip"), t("workspace.column.upload"), t("workspace.column.git"))
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.label(baseDir), orDash(r.oldVersion), orDash(r.newVersion), orDash(r.zipName),
+			stageLabel(r.upload), stageLabel(r.git))
+	}
+	w.Flush()
+
+	logAndPrint("")
+	logAndPrint(t("workspace.summary"))
+	for _, line := range splitLines(b.String()) {
+		logAndPrint(line)
+	}
+	for _, r := range results {
+		if r.err != nil {
+			logAndPrint(t("workspace.plugin_failed", r.label(baseDir), r.err))
+		}
+	}
+}
+
+// label names the plugin by its directory and, if it differs from the
+// directory name, its slug, so plugins with the same slug can be told apart.
+func (r workspaceResult) label(baseDir string) string {
+	dir := r.dir
+	if rel, err := filepath.Rel(baseDir, r.dir); err == nil {
+		dir = rel
+	}
+	if r.slug == "" || r.slug == filepath.Base(r.dir) {
+		return dir
+	}
+	return fmt.Sprintf("%s (%s)", dir, r.slug)
+}
+
+func stageLabel(status string) string {
+	if status == "" {
+		return "-"
+	}
+	return t("workspace.stage." + status)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
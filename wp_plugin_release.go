@@ -56,58 +56,18 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strings"
 	"time"
-
-	"github.com/janmz/sconfig"
 )
 
 var logger *log.Logger
 var logFile *os.File
-var config ConfigType
-
-func parseCLIArgs(args []string) (workDir string, fetchHostKey bool, commitMessage string, verboseFlag bool) {
-	workDir = ""
-	fetchHostKey = false
-	commitMessage = ""
-	verboseFlag = false
-
-	for i := 0; i < len(args); i++ {
-		a := strings.TrimSpace(args[i])
-		if a == "" {
-			continue
-		}
-		switch a {
-		case "-fetch-hostkey", "-trustserver":
-			fetchHostKey = true
-			continue
-		case "-v", "-verbose":
-			verboseFlag = true
-			continue
-		case "-c", "-commit":
-			if i+1 < len(args) {
-				commitMessage = strings.TrimSpace(args[i+1])
-				i++
-			}
-			continue
-		default:
-			if strings.HasPrefix(a, "-") {
-				continue
-			}
-			if workDir == "" {
-				workDir = a
-			}
-		}
-	}
-	return workDir, fetchHostKey, commitMessage, verboseFlag
-}
 
 func main() {
-	
+
 	executablePath, err := os.Executable()
 	if err != nil {
 		executablePath = os.Args[0]
@@ -121,137 +81,139 @@ func main() {
 		buildTimeStr = buildTime.Local().Format("2006-01-02 15:04:05")
 	}
 
-	fmt.Printf("%s, %s\n", t("app.executable_path", executablePath), t("app.version", Version, buildTimeStr))
+	opts, err := parseCLIArgs(os.Args[1:])
+	if err == nil && opts.jsonOutput {
+		console = os.Stderr
+	}
+	fmt.Fprintf(console, "%s, %s\n", t("app.executable_path", executablePath), t("app.version", Version, buildTimeStr))
+	if err != nil {
+		fmt.Fprintf(console, "%s", t("error.cli_args", err)+"\n\n")
+		fmt.Fprint(console, usageText())
+		os.Exit(2)
+	}
+	if opts.showVersion {
+		return
+	}
+	if opts.showHelp {
+		fmt.Fprint(console, usageText())
+		return
+	}
+	verbose = opts.verbose
+	dryRun = opts.dryRun
 
-	workDir, fetchHostKey, commitMessage, verboseFlag := parseCLIArgs(os.Args[1:])
-	verbose = verboseFlag
+	if opts.workspace != "" {
+		os.Exit(runWorkspace(opts))
+	}
 
+	workDir := opts.workDir
 	if workDir == "" {
 		var err2 error
 		workDir, err2 = os.Getwd()
 		if err2 != nil {
-			fmt.Printf("%s", t("error.current_directory", err2)+"\n")
+			fmt.Fprintf(console, "%s", t("error.current_directory", err2)+"\n")
 			os.Exit(1)
 		}
 	}
 	if _, err := os.Stat(workDir); os.IsNotExist(err) {
-		fmt.Printf("%s", t("error.no_directory", workDir)+"\n")
+		fmt.Fprintf(console, "%s", t("error.no_directory", workDir)+"\n")
 		os.Exit(1)
 	}
 
+	if opts.command == "init" {
+		initLogging(workDir)
+		defer logFile.Close()
+		logRunModes()
+		if err := runInit(workDir, opts); err != nil {
+			logAndPrint(err.Error())
+			os.Exit(1)
+		}
+		logCommandCompleted(opts.command)
+		return
+	}
+
 	updateConfigPath := filepath.Join(workDir, "update.config")
 	if _, err := os.Stat(updateConfigPath); os.IsNotExist(err) {
-		fmt.Printf("%s", t("error.no_config", workDir)+"\n")
+		fmt.Fprintf(console, "%s", t("error.no_config", workDir)+"\n")
 		os.Exit(1)
 	}
 
 	initLogging(workDir)
 	defer logFile.Close()
+	logRunModes()
 
-	if verbose {
-		logAndPrint(t("log.verbose_enabled"))
-	}
-
-	err = sconfig.LoadConfig(&config, 2, updateConfigPath, false, false)
+	ctx, err := newReleaseContext(workDir, opts)
 	if err != nil {
-		logAndPrint(t("error.config_read", err))
-		os.Exit(1)
-	}
-
-	updateInfoPath := filepath.Join(workDir, "Updates", "update_info.json")
-	updateInfo, allData, err := getUpdateInfo(updateInfoPath)
-	if err != nil {
-		logAndPrint(t("error.update_info_read", err))
+		logAndPrint(err.Error())
+		if err := writeReports(opts, false, newFailedReport(workDir, opts, err)); err != nil {
+			logAndPrint(t("error.report_write", err))
+		}
 		os.Exit(1)
 	}
 
 	logVerbose(t("app.working_directory", workDir))
 
-	currentVersion, err := processMainPHPFile(workDir, config.MainPHPFile, updateInfo)
+	err = ctx.runCommand(findCommand(opts.command))
 	if err != nil {
-		logAndPrint(t("error.php_processing", err))
-		os.Exit(1)
+		logAndPrint(err.Error())
+	} else {
+		logCommandCompleted(opts.command)
 	}
-	logAndPrint(t("log.current_version_detected", currentVersion))
-
-	err = processUpdateInfo(updateInfo, currentVersion)
-	if err != nil {
-		logAndPrint(t("error.update_info_processing", err))
+	if err := writeReports(opts, false, ctx.report(err)); err != nil {
+		logAndPrint(t("error.report_write", err))
 		os.Exit(1)
 	}
-
-	changelogText, err := processChangelog(workDir, currentVersion, commitMessage)
-	if err != nil {
-		logAndPrint(t("error.changelog_write", err))
-	} else if changelogText != "" {
-		updateChangelogInUpdateInfo(workDir, updateInfo, changelogText)
-	}
-
-	err = processSVGFiles(workDir)
 	if err != nil {
-		logAndPrint(t("error.svg_convert", err))
+		os.Exit(1)
 	}
+}
 
-	remoteZIPName := filepath.Base(updateInfo.DownloadURL)
-	re := regexp.MustCompile(`-v?[0-9.]*\.zip$`)
-	remoteZIPName2 := re.ReplaceAllString(remoteZIPName, "")
-	if updateInfo.Slug == "" {
-		updateInfo.Slug = remoteZIPName2
-	}
-	if re.MatchString(remoteZIPName2) {
-		logAndPrint(t("error.zip_version_remove"))
-		remoteZIPName2 = strings.TrimSuffix(remoteZIPName2, ".zip")
+func logCommandCompleted(command string) {
+	switch {
+	case dryRun:
+		logAndPrint(t("app.dry_run_completed"))
+	case command == "release":
+		logAndPrint(t("app.release_process_completed"))
+	case command != "status" && command != "verify" && command != "validate":
+		logAndPrint(t("app.command_completed", command))
 	}
+}
 
-	zipFileName := fmt.Sprintf("%s-v%s.zip", remoteZIPName2, currentVersion)
-	zipPath := filepath.Join(workDir, "Updates", zipFileName)
-	err = createZipFile(workDir, zipPath, config.SkipPattern, updateInfo.Slug)
-	if err != nil {
-		logAndPrint(t("error.zip_creation", err))
-		os.Exit(1)
-	}
-	updateInfo.DownloadURL = strings.TrimSuffix(updateInfo.DownloadURL, remoteZIPName) + zipFileName
-	logVerbose(t("log.download_url_set", redactSensitiveURL(updateInfo.DownloadURL)))
+func initLogging(workDir string) {
+	initLogFile(filepath.Join(workDir, "update.log"))
+}
 
-	err = setUpdateInfo(updateInfo, allData, updateInfoPath)
+func initLogFile(logPath string) {
+	var err error
+	logFile, logger, err = openLogFile(logPath)
 	if err != nil {
-		logAndPrint(t("error.update_info_processing", err))
+		fmt.Fprintf(console, "%s", t("error.log_file", err)+"\n")
 		os.Exit(1)
 	}
-	logAndPrint(t("log.zip_file_created", zipFileName))
+}
 
-	if config.SSHHost != "" && config.SSHUser != "" {
-		err = uploadFiles(&config, zipPath, updateInfoPath, workDir, updateInfo, fetchHostKey)
-		if err != nil {
-			logAndPrint(t("error.upload", err))
-		} else {
-			logAndPrint(t("log.upload_completed"))
-		}
-	} else {
-		logAndPrint(t("log.no_ssh_config"))
+// openLogFile opens the log file for appending. A dry run writes no file, not
+// even the log, so its logger discards the messages and the file is nil.
+func openLogFile(logPath string) (*os.File, *log.Logger, error) {
+	if dryRun {
+		return nil, log.New(io.Discard, "", log.LstdFlags), nil
 	}
-
-	err = handleGitHubIntegration(workDir, updateInfo, zipPath, commitMessage)
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) // # nosec G304
 	if err != nil {
-		logAndPrint(t("error.github_check", err))
-		os.Exit(1)
+		return nil, nil, err
 	}
-
-	logAndPrint(t("app.release_process_completed"))
+	return file, log.New(file, "", log.LstdFlags), nil
 }
 
-func initLogging(workDir string) {
-	logPath := filepath.Join(workDir, "update.log")
-	var err error
-	logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) // # nosec G304
-	if err != nil {
-		fmt.Printf("%s", t("error.log_file", err)+"\n")
-		os.Exit(1)
+func logRunModes() {
+	if verbose {
+		logAndPrint(t("log.verbose_enabled"))
+	}
+	if dryRun {
+		logAndPrint(t("log.dry_run_enabled"))
 	}
-	logger = log.New(logFile, "", log.LstdFlags)
 }
 
 func logAndPrint(message string) {
-	fmt.Println(message)
+	fmt.Fprintln(console, message)
 	logger.Println(message)
 }
@@ -2,13 +2,24 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
+
+	sshcommands "github.com/janmz/ssh-commands"
 )
 
 func init() {
@@ -64,6 +75,7 @@ func TestUpdateInfoReadProcessWrite(ts *testing.T) {
 	uiPath := filepath.Join(dir, "Updates", "update_info.json")
 	// initial content has older version and extra unknown field
 	initial := map[string]any{
+		"name":         "Plugin",
 		"version":      "1.0.0",
 		"last_updated": "2024-01-01 00:00:00",
 		"download_url": "https://example.com/plugin/plugin-v1.0.0.zip",
@@ -80,7 +92,7 @@ func TestUpdateInfoReadProcessWrite(ts *testing.T) {
 		ts.Fatalf("unexpected getUpdateInfo results: ui=%+v all=%+v", ui, all)
 	}
 
-	if err := processUpdateInfo(ui, "1.2.0"); err != nil {
+	if err := processUpdateInfo(ui, "1.2.0", "2026-01-02 03:04:05"); err != nil {
 		ts.Fatalf("processUpdateInfo error: %v", err)
 	}
 	if ui.Version != "1.2.0" {
@@ -122,7 +134,7 @@ func TestShouldSkipAndZipCreation(ts *testing.T) {
 
 	zipPath := filepath.Join(dir, "Updates", "out.zip")
 	// custom skip to ignore .log files
-	if err := createZipFile(dir, zipPath, []string{"*.log"}, "slug"); err != nil {
+	if _, err := createZipFile(dir, zipPath, []string{"*.log"}, "slug"); err != nil {
 		ts.Fatalf("createZipFile error: %v", err)
 	}
 
@@ -207,10 +219,13 @@ $updateChecker = PucFactory::buildUpdateChecker('https://example.com/updates/plu
 	initLogging(dir)
 	defer logFile.Close()
 
-	ver, err := processMainPHPFile(dir, main, ui)
+	ver, err := processMainPHPFile(dir, main, ui, "", "", "", "2026-01-02 03:04:05")
 	if err != nil {
 		ts.Fatalf("processMainPHPFile error: %v", err)
 	}
+	if err := syncPUCCall(dir, main, ui, "update_info.json"); err != nil {
+		ts.Fatalf("syncPUCCall error: %v", err)
+	}
 	if ver != "1.2.0" { // highest of 1.0.0 and 1.2.0
 		ts.Fatalf("expected detected version 1.2.0, got %q", ver)
 	}
@@ -234,7 +249,7 @@ $updateChecker = PucFactory::buildUpdateChecker('https://example.com/updates/plu
 
 func TestProcessUpdateInfo_NoChangeWhenNewer(ts *testing.T) {
 	ui := &UpdateInfo{Version: "2.0.0"}
-	if err := processUpdateInfo(ui, "1.9.9"); err != nil {
+	if err := processUpdateInfo(ui, "1.9.9", "2026-01-02 03:04:05"); err != nil {
 		ts.Fatalf("processUpdateInfo: %v", err)
 	}
 	if ui.Version != "2.0.0" {
@@ -281,24 +296,1505 @@ func TestRedactSensitiveURL(ts *testing.T) {
 }
 
 func TestParseCLIArgsVerbose(ts *testing.T) {
-	workDir, fetchHostKey, commitMessage, verboseFlag := parseCLIArgs([]string{
+	opts, err := parseCLIArgs([]string{
 		"-verbose", "-fetch-hostkey", "-c", "release msg", "/tmp/plugin",
 	})
-	if !verboseFlag {
+	if err != nil {
+		ts.Fatalf("parseCLIArgs error: %v", err)
+	}
+	if !opts.verbose {
 		ts.Fatal("expected verbose flag")
 	}
-	if !fetchHostKey {
+	if !opts.fetchHostKey {
 		ts.Fatal("expected fetchHostKey")
 	}
-	if commitMessage != "release msg" {
-		ts.Fatalf("commitMessage=%q", commitMessage)
+	if opts.commitMessage != "release msg" {
+		ts.Fatalf("commitMessage=%q", opts.commitMessage)
+	}
+	if opts.workDir != "/tmp/plugin" {
+		ts.Fatalf("workDir=%q", opts.workDir)
+	}
+	if opts.command != "release" {
+		ts.Fatalf("expected default command release, got %q", opts.command)
+	}
+
+	opts, err = parseCLIArgs([]string{"-v", "."})
+	if err != nil || !opts.verbose {
+		ts.Fatalf("expected -v to enable verbose, err=%v", err)
+	}
+
+	opts, err = parseCLIArgs([]string{".", "-dry-run"})
+	if err != nil || !opts.dryRun {
+		ts.Fatalf("expected -dry-run after the directory to enable dry run, err=%v", err)
+	}
+}
+
+func TestParseCLIArgsCommands(ts *testing.T) {
+	opts, err := parseCLIArgs([]string{"upload", "--trustserver", "/tmp/plugin"})
+	if err != nil {
+		ts.Fatalf("parseCLIArgs error: %v", err)
+	}
+	if opts.command != "upload" || !opts.fetchHostKey || opts.workDir != "/tmp/plugin" {
+		ts.Fatalf("unexpected options: %+v", opts)
+	}
+
+	opts, err = parseCLIArgs([]string{"--help"})
+	if err != nil || !opts.showHelp {
+		ts.Fatalf("expected --help, err=%v", err)
+	}
+	opts, err = parseCLIArgs([]string{"status", "--version"})
+	if err != nil || !opts.showVersion {
+		ts.Fatalf("expected --version, err=%v", err)
+	}
+
+	if _, err := parseCLIArgs([]string{"-xyz", "."}); err == nil {
+		ts.Fatal("expected error for unknown flag")
+	}
+	if _, err := parseCLIArgs([]string{"release", "a", "b"}); err == nil {
+		ts.Fatal("expected error for too many arguments")
+	}
+}
+
+func TestDryRunLeavesFilesUntouched(ts *testing.T) {
+	dryRun = true
+	defer func() {
+		dryRun = false
+		plannedFiles = make(map[string][]byte)
+	}()
+
+	dir := ts.TempDir()
+	php := `<?php
+/*
+ * Plugin Name: TestPlugin
+ * Version: 1.0.0
+ */
+$updateChecker = PucFactory::buildUpdateChecker('https://example.com/updates/update_info.json', __FILE__, 'slug');
+`
+	writeFile(ts, filepath.Join(dir, "plugin.php"), php)
+	initLogging(dir)
+	defer logFile.Close()
+
+	ui := &UpdateInfo{DownloadURL: "https://example.com/updates/slug-v1.0.0.zip", Slug: "slug"}
+	if _, err := processMainPHPFile(dir, "plugin.php", ui, "", "", "", "2026-01-02 03:04:05"); err != nil {
+		ts.Fatalf("processMainPHPFile error: %v", err)
+	}
+	if err := syncPUCCall(dir, "plugin.php", ui, "update_info.json"); err != nil {
+		ts.Fatalf("syncPUCCall error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "plugin.php"))
+	if string(b) != php {
+		ts.Fatalf("dry run modified PHP file: %s", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "plugin.php.bak")); err == nil {
+		ts.Fatal("dry run created a backup file")
+	}
+
+	if err := writeChangelog(dir, "1.0.0", "planned entry"); err != nil {
+		ts.Fatalf("writeChangelog error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Changelog.md")); err == nil {
+		ts.Fatal("dry run created Changelog.md")
+	}
+	text, err := readChangelog(dir, "1.0.0")
+	if err != nil || !strings.Contains(text, "planned entry") {
+		ts.Fatalf("planned changelog not visible to later steps: %q, %v", text, err)
+	}
+
+	zipPath := filepath.Join(dir, "Updates", "slug-v1.0.0.zip")
+	if _, err := createZipFile(dir, zipPath, nil, "slug"); err != nil {
+		ts.Fatalf("createZipFile error: %v", err)
+	}
+	if _, err := os.Stat(zipPath); err == nil {
+		ts.Fatal("dry run created the ZIP file")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "update.log")); err == nil {
+		ts.Fatal("dry run created update.log")
+	}
+}
+
+func TestBumpVersion(ts *testing.T) {
+	cases := []struct{ version, level, want string }{
+		{"1.2.3", "major", "2.0.0"},
+		{"1.2.3", "minor", "1.3.0"},
+		{"1.2.3", "patch", "1.2.4"},
+		{"1.2.3", "build", "1.2.3.1"},
+		{"1.6.3.86", "build", "1.6.3.87"},
+		{"1.6.3.86", "patch", "1.6.4.0"},
+		{"1.9", "patch", "1.9.1"},
+		{"1.9.9", "minor", "1.10.0"},
+	}
+	for _, c := range cases {
+		got, err := bumpVersion(c.version, c.level)
+		if err != nil || got != c.want {
+			ts.Fatalf("bumpVersion(%q,%q)=%q,%v want %q", c.version, c.level, got, err, c.want)
+		}
+	}
+	if _, err := bumpVersion("1.2.3", "huge"); err == nil {
+		ts.Fatal("expected error for unknown level")
+	}
+}
+
+func TestProcessMainPHPFile_Bump(ts *testing.T) {
+	dir := ts.TempDir()
+	php := `<?php
+/*
+ * Plugin Name: TestPlugin
+ * Version: 1.9.9
+ */
+define('TEST_VERSION', '1.9.9');
+class TestPlugin { private $version = '1.9.9'; }
+$updateChecker = PucFactory::buildUpdateChecker('https://example.com/updates/update_info.json', __FILE__, 'slug');
+`
+	writeFile(ts, filepath.Join(dir, "plugin.php"), php)
+	initLogging(dir)
+	defer logFile.Close()
+
+	ui := &UpdateInfo{DownloadURL: "https://example.com/updates/slug-v1.9.9.zip", Slug: "slug"}
+	ver, err := processMainPHPFile(dir, "plugin.php", ui, "minor", "", "", "2026-01-02 03:04:05")
+	if err != nil {
+		ts.Fatalf("processMainPHPFile error: %v", err)
+	}
+	if ver != "1.10.0" {
+		ts.Fatalf("expected bumped version 1.10.0, got %q", ver)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "plugin.php"))
+	s := string(b)
+	for _, want := range []string{"Version: 1.10.0", "define('TEST_VERSION', '1.10.0');", "private $version = '1.10.0';"} {
+		if !strings.Contains(s, want) {
+			ts.Fatalf("expected %q in bumped file:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "1.9.9") {
+		ts.Fatalf("old version left in bumped file:\n%s", s)
+	}
+}
+
+func TestWriteChangelogHeaderRenamesUnreleased(ts *testing.T) {
+	dir := ts.TempDir()
+	writeFile(ts, filepath.Join(dir, "Changelog.md"), "# Changelog\n\n## [Unreleased]\n\n- Pending fix\n\n## [1.0.0] - 2024-01-01\n\n- First\n")
+	if err := writeChangelogHeader(dir, "1.1.0"); err != nil {
+		ts.Fatalf("writeChangelogHeader error: %v", err)
+	}
+	text, err := readChangelog(dir, "1.1.0")
+	if err != nil || text != "- Pending fix" {
+		ts.Fatalf("unreleased section not renamed: %q, %v", text, err)
+	}
+}
+
+func TestGetHigherVersionPreRelease(ts *testing.T) {
+	cases := []struct{ a, b, want string }{
+		{"1.2.0-beta.2", "1.2.0", "1.2.0"},
+		{"1.2.0-beta.2", "1.2.0-beta.10", "1.2.0-beta.10"},
+		{"1.2.0-alpha", "1.2.0-beta", "1.2.0-beta"},
+		{"1.2.0-rc.1", "1.2.0-beta.5", "1.2.0-rc.1"},
+		{"1.2.0-beta", "1.2.0-beta.1", "1.2.0-beta.1"},
+		{"1.2.0-1", "1.2.0-alpha", "1.2.0-alpha"},
+		{"1.2.1-beta.1", "1.2.0", "1.2.1-beta.1"},
+		{"1.2.0+build.5", "1.2.0+build.7", "1.2.0+build.5"},
+	}
+	for _, c := range cases {
+		if got := getHigherVersion(c.a, c.b); got != c.want {
+			ts.Fatalf("getHigherVersion(%q,%q)=%q want %q", c.a, c.b, got, c.want)
+		}
+	}
+
+	if got, _ := bumpVersion("1.3.0-rc.1", "patch"); got != "1.3.0" {
+		ts.Fatalf("bumping a pre-release should release it, got %q", got)
+	}
+	if got, _ := bumpVersion("1.3.2-rc.1", "minor"); got != "1.4.0" {
+		ts.Fatalf("bumpVersion(1.3.2-rc.1, minor)=%q want 1.4.0", got)
+	}
+}
+
+func TestPreReleaseDetectionAndZipName(ts *testing.T) {
+	php := `<?php
+/*
+ * Plugin Name: TestPlugin
+ * Version: 1.2.0-beta.2
+ */
+define('TEST_VERSION', '1.2.0-beta.1');
+`
+	if got := findPHPVersions(php).highest(); got != "1.2.0-beta.2" {
+		ts.Fatalf("expected pre-release version 1.2.0-beta.2, got %q", got)
+	}
+
+	re := regexp.MustCompile(zipVersionPattern)
+	for name, want := range map[string]string{
+		"slug-v1.2.0-rc.1.zip":       "slug",
+		"slug-v1.2.0.zip":            "slug",
+		"slug-1.2.0+build.3.zip":     "slug",
+		"two-factor-v1.0.zip":        "two-factor",
+		"plugin-2-factor-v1.0.1.zip": "plugin-2-factor",
+	} {
+		if got := re.ReplaceAllString(name, ""); got != want {
+			ts.Fatalf("removing version from %q gave %q want %q", name, got, want)
+		}
+	}
+}
+
+func TestChannelUpdateInfo(ts *testing.T) {
+	dir := ts.TempDir()
+	writeFile(ts, filepath.Join(dir, "Updates", "update_info.json"),
+		`{"name":"Plugin","version":"1.0.0","download_url":"https://example.com/updates/slug/slug-v1.0.0.zip"}`)
+	config := &ConfigType{Channels: map[string]ChannelConfig{"beta": {DownloadPath: "beta"}}}
+
+	path, ui, all, err := loadChannelUpdateInfo(dir, config, "beta")
+	if err != nil {
+		ts.Fatalf("loadChannelUpdateInfo error: %v", err)
+	}
+	if filepath.Base(path) != "update_info-beta.json" {
+		ts.Fatalf("unexpected channel feed %q", path)
+	}
+	if ui.DownloadURL != "https://example.com/updates/slug/beta/slug-v1.0.0.zip" {
+		ts.Fatalf("unexpected channel download URL %q", ui.DownloadURL)
+	}
+
+	// A second release must not nest the relative download path again.
+	if err := setUpdateInfo(ui, all, path); err != nil {
+		ts.Fatalf("setUpdateInfo error: %v", err)
+	}
+	_, ui, _, err = loadChannelUpdateInfo(dir, config, "beta")
+	if err != nil || ui.DownloadURL != "https://example.com/updates/slug/beta/slug-v1.0.0.zip" {
+		ts.Fatalf("download URL changed on reload: %q, %v", ui.DownloadURL, err)
+	}
+
+	if _, _, _, err := loadChannelUpdateInfo(dir, config, "nightly"); err == nil {
+		ts.Fatal("expected error for unknown channel")
+	}
+	path, _, _, err = loadChannelUpdateInfo(dir, config, "")
+	if err != nil || filepath.Base(path) != "update_info.json" {
+		ts.Fatalf("default channel should use update_info.json: %q, %v", path, err)
+	}
+}
+
+func TestLoadWorkspace(ts *testing.T) {
+	dir := ts.TempDir()
+	wsPath := filepath.Join(dir, "plugins.json")
+	abs := filepath.Join(ts.TempDir(), "other")
+	raw, _ := json.Marshal(map[string]interface{}{"plugins": []string{"a", "../b", abs}, "parallel": 2})
+	writeFile(ts, wsPath, string(raw))
+
+	ws, dirs, err := loadWorkspace(wsPath)
+	if err != nil {
+		ts.Fatalf("loadWorkspace error: %v", err)
+	}
+	want := []string{filepath.Join(dir, "a"), filepath.Join(filepath.Dir(dir), "b"), abs}
+	if ws.Parallel != 2 || !reflect.DeepEqual(dirs, want) {
+		ts.Fatalf("unexpected workspace %d %v", ws.Parallel, dirs)
+	}
+
+	writeFile(ts, wsPath, `{"plugins":[]}`)
+	if _, _, err := loadWorkspace(wsPath); err == nil {
+		ts.Fatal("expected error for empty workspace")
+	}
+	if _, err := parseCLIArgs([]string{"-workspace", wsPath, "/some/plugin"}); err == nil {
+		ts.Fatal("expected error for plugin directory with -workspace")
 	}
-	if workDir != "/tmp/plugin" {
-		ts.Fatalf("workDir=%q", workDir)
+}
+
+func TestWorkspaceSummary(ts *testing.T) {
+	var out bytes.Buffer
+	console = &out
+	defer func() { console = os.Stdout }()
+
+	dir := ts.TempDir()
+	php := "<?php\n/*\n * Plugin Name: Shop\n * Version: 1.1.0\n */\n"
+	feed := `{"version":"1.0.0","slug":"shop","download_url":"https://example.com/updates/shop-v1.0.0.zip"}`
+	for _, plugin := range []string{"a", "b"} {
+		writeFile(ts, filepath.Join(dir, plugin, "update.config"), `{"main_php_file":"shop.php","puc":false}`)
+		writeFile(ts, filepath.Join(dir, plugin, "shop.php"), php)
+		writeFile(ts, filepath.Join(dir, plugin, "Updates", "update_info.json"), feed)
+	}
+	writeFile(ts, filepath.Join(dir, "c", "c.php"), php)
+	wsPath := filepath.Join(dir, "plugins.json")
+	writeFile(ts, wsPath, `{"plugins":["a","b","c"]}`)
+
+	if code := runWorkspace(&cliOptions{command: "status", workspace: wsPath}); code != 1 {
+		ts.Fatalf("exit code %d for a failed plugin, want 1", code)
+	}
+	_, summary, _ := strings.Cut(out.String(), t("workspace.summary"))
+	lines := splitLines(strings.TrimSpace(summary))
+	if len(lines) != 5 {
+		ts.Fatalf("unexpected summary:\n%s", summary)
+	}
+	header := []string{}
+	for _, column := range []string{"plugin", "old_version", "new_version", "zip", "upload", "git"} {
+		header = append(header, regexp.QuoteMeta(t("workspace.column."+column)))
+	}
+	failed := regexp.QuoteMeta(t("workspace.plugin_failed", "c", t("error.no_config", filepath.Join(dir, "c"))))
+	for i, want := range []string{`^` + strings.Join(header, `\s+`) + `$`, `^a \(shop\)\s+1\.0\.0\s+1\.1\.0\s+-\s+-\s+-$`, `^b \(shop\)\s+1\.0\.0\s+1\.1\.0\s+-\s+-\s+-$`, `^c\s+-\s+-\s+-\s+-\s+-$`, `^` + failed + `$`} {
+		if !regexp.MustCompile(want).MatchString(lines[i]) {
+			ts.Fatalf("summary line %d = %q, want %s", i, lines[i], want)
+		}
+	}
+}
+
+func TestSSHClientPoolReusesConnections(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	var dialed []string
+	var uploads []string
+	closed := 0
+	pool := newSSHClientPool()
+	pool.dial = func(opts *sshcommands.Opts, knownHosts sshcommands.KnownHostsOptions) (*sshConnection, error) {
+		dialed = append(dialed, fmt.Sprintf("%s@%s:%d", opts.User, opts.Host, opts.Port))
+		return &sshConnection{
+			mkdirAll: func(remotePath string) error { return nil },
+			upload: func(localPath, remotePath string) error {
+				uploads = append(uploads, remotePath)
+				return nil
+			},
+			close: func() { closed++ },
+		}, nil
+	}
+
+	config := &ConfigType{SSHHost: "example.com", SSHUser: "deploy", SSHPassword: "secret", SSHKnownHosts: "known_hosts"}
+	for _, slug := range []string{"a", "b"} {
+		items := []uploadItem{{filepath.Join(dir, slug+".zip"), "/srv/" + slug + ".zip", "error.zip_upload"}}
+		if n, err := transferFiles(config, dir, "/srv", items, false, pool); err != nil || n != 1 {
+			ts.Fatalf("transferFiles = %d, %v", n, err)
+		}
+	}
+	config.SSHPort = "2222"
+	if _, err := transferFiles(config, dir, "/srv", nil, false, pool); err != nil {
+		ts.Fatalf("transferFiles error: %v", err)
+	}
+	if want := []string{"deploy@example.com:22", "deploy@example.com:2222"}; !reflect.DeepEqual(dialed, want) {
+		ts.Fatalf("dialed %v, want %v", dialed, want)
+	}
+	if want := []string{"/srv/a.zip", "/srv/b.zip"}; !reflect.DeepEqual(uploads, want) {
+		ts.Fatalf("uploaded %v, want %v", uploads, want)
+	}
+	pool.Close()
+	if closed != 2 || len(pool.connections) != 0 {
+		ts.Fatalf("closed %d connections, %d left", closed, len(pool.connections))
+	}
+}
+
+func TestFailedCommandRollsBack(ts *testing.T) {
+	dir := ts.TempDir()
+	php := `<?php
+/*
+ * Plugin Name: TestPlugin
+ * Version: 1.0.0
+ */
+`
+	feed := `{"version":"1.0.0","slug":"slug","download_url":"https://example.com/updates/slug-v1.0.0.zip"}`
+	writeFile(ts, filepath.Join(dir, "plugin.php"), php)
+	writeFile(ts, filepath.Join(dir, "plugin.php.bak"), "old backup")
+	writeFile(ts, filepath.Join(dir, "Updates", "update_info.json"), feed)
+
+	updateInfoPath := filepath.Join(dir, "Updates", "update_info.json")
+	ui, all, err := getUpdateInfo(updateInfoPath)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	ctx := &releaseContext{
+		workDir:        dir,
+		opts:           &cliOptions{bumpLevel: "minor"},
+		config:         ConfigType{MainPHPFile: "plugin.php"},
+		updateInfoPath: updateInfoPath,
+		updateInfo:     ui,
+		allData:        all,
+	}
+	failing := &cliCommand{name: "release", run: func(ctx *releaseContext) error {
+		if err := ctx.syncVersion(); err != nil {
+			return err
+		}
+		if err := ctx.buildZip(); err != nil {
+			return err
+		}
+		if err := ctx.saveUpdateInfo(); err != nil {
+			return err
+		}
+		return fmt.Errorf("upload failed")
+	}}
+	if err := ctx.runCommand(failing); err == nil {
+		ts.Fatal("expected the command to fail")
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(dir, "plugin.php"):     php,
+		filepath.Join(dir, "plugin.php.bak"): "old backup",
+		updateInfoPath:                       feed,
+	} {
+		if b, err := os.ReadFile(path); err != nil || string(b) != want {
+			ts.Fatalf("%s not restored: %q, %v", path, b, err)
+		}
+	}
+	for _, path := range []string{
+		filepath.Join(dir, "Updates", "slug-v1.1.0.zip"),
+		updateInfoPath + ".bak",
+	} {
+		if _, err := os.Stat(path); err == nil {
+			ts.Fatalf("%s was not removed", path)
+		}
+	}
+}
+
+func TestRollbackWithRelativeWorkDir(ts *testing.T) {
+	base := ts.TempDir()
+	ts.Chdir(base)
+	dir := "my-plugin"
+	php := "<?php\n/*\n * Plugin Name: TestPlugin\n * Version: 1.0.0\n */\n"
+	feed := `{"name":"TestPlugin","version":"1.0.0","slug":"slug","download_url":"https://example.com/updates/slug-v1.0.0.zip"}`
+	writeFile(ts, filepath.Join(dir, "my-plugin.php"), php)
+	writeFile(ts, filepath.Join(dir, "Updates", "update_info.json"), feed)
+	initLogging(dir)
+	defer logFile.Close()
+
+	updateInfoPath := filepath.Join(dir, "Updates", "update_info.json")
+	ui, all, err := getUpdateInfo(updateInfoPath)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	noPUC := false
+	ctx := &releaseContext{
+		workDir:        dir,
+		opts:           &cliOptions{command: "bump", bumpLevel: "patch"},
+		config:         ConfigType{MainPHPFile: "my-plugin.php", PUC: &noPUC},
+		updateInfoPath: updateInfoPath,
+		updateInfo:     ui,
+		allData:        all,
+	}
+	failing := &cliCommand{name: "bump", run: func(ctx *releaseContext) error {
+		if err := ctx.syncVersion(); err != nil {
+			return err
+		}
+		return fmt.Errorf("upload failed")
+	}}
+	if err := ctx.runCommand(failing); err == nil {
+		ts.Fatal("expected the command to fail")
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "my-plugin.php")); string(b) != php {
+		ts.Fatalf("main PHP file not restored:\n%s", b)
+	}
+	if fileExists(filepath.Join(dir, "my-plugin.php.bak")) {
+		ts.Fatal("backup of the main PHP file left behind")
+	}
+}
+
+func TestFetchRemoteUpdateInfo(ts *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/updates/slug/update_info.json":
+			fmt.Fprint(w, `{"version":"1.0.0"}`)
+		case "/updates/slug/update_info-beta.json":
+			http.NotFound(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	downloadURL := server.URL + "/updates/slug/slug-v1.1.0.zip?token=x"
+	data, found, err := fetchRemoteUpdateInfo(downloadURL, "update_info.json")
+	if err != nil || !found || string(data) != `{"version":"1.0.0"}` {
+		ts.Fatalf("fetchRemoteUpdateInfo = %q, %v, %v", data, found, err)
+	}
+	if _, found, err := fetchRemoteUpdateInfo(downloadURL, "update_info-beta.json"); err != nil || found {
+		ts.Fatalf("missing feed: found=%v, err=%v", found, err)
+	}
+	if _, _, err := fetchRemoteUpdateInfo(server.URL+"/broken/slug.zip", "update_info.json"); err == nil {
+		ts.Fatal("expected error for a server error")
+	}
+}
+
+func TestFailedCommitRollsBack(ts *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		ts.Skip("git not installed")
+	}
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+	ts.Setenv("AUTO_GITHUB_UPDATE", "yes")
+
+	php := "<?php\n/*\n * Plugin Name: TestPlugin\n * Version: 1.0.0\n */\n"
+	feed := `{"name":"TestPlugin","version":"1.0.0","slug":"slug","download_url":"https://example.com/updates/slug-v1.0.0.zip"}`
+	writeFile(ts, filepath.Join(dir, "plugin.php"), php)
+	writeFile(ts, filepath.Join(dir, "Updates", "update_info.json"), feed)
+	writeFile(ts, filepath.Join(dir, "notes.txt"), "notes")
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "commit.gpgsign", "false"},
+		{"remote", "add", "origin", "https://github.com/example/slug.git"},
+		{"add", "plugin.php", "Updates"},
+		{"commit", "--quiet", "-m", "init"},
+		{"add", "notes.txt"},
+	} {
+		if err := runGitCommand(dir, args...); err != nil {
+			ts.Fatalf("git %v: %v", args, err)
+		}
+	}
+	// A pre-commit hook rejects the release commit.
+	writeFile(ts, filepath.Join(dir, ".git", "hooks", "pre-commit"), "#!/bin/sh\nexit 1\n")
+	if err := os.Chmod(filepath.Join(dir, ".git", "hooks", "pre-commit"), 0755); err != nil {
+		ts.Fatalf("chmod: %v", err)
+	}
+
+	updateInfoPath := filepath.Join(dir, "Updates", "update_info.json")
+	ui, all, err := getUpdateInfo(updateInfoPath)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	noPUC := false
+	ctx := &releaseContext{
+		workDir:        dir,
+		opts:           &cliOptions{bumpLevel: "minor"},
+		config:         ConfigType{MainPHPFile: "plugin.php", PUC: &noPUC},
+		updateInfoPath: updateInfoPath,
+		updateInfo:     ui,
+		allData:        all,
+	}
+	committing := &cliCommand{name: "release", run: func(ctx *releaseContext) error {
+		if err := ctx.syncVersion(); err != nil {
+			return err
+		}
+		if err := ctx.saveUpdateInfo(); err != nil {
+			return err
+		}
+		return ctx.gitRelease()
+	}}
+	if err := ctx.runCommand(committing); err == nil {
+		ts.Fatal("expected the commit to fail")
+	}
+
+	if b, _ := os.ReadFile(filepath.Join(dir, "plugin.php")); string(b) != php {
+		ts.Fatalf("plugin.php not restored:\n%s", b)
+	}
+	if b, _ := os.ReadFile(updateInfoPath); string(b) != feed {
+		ts.Fatalf("update_info.json not restored:\n%s", b)
+	}
+	// Only the file staged before the release is left in the index.
+	staged, err := runGitCommandOutput(dir, "diff", "--cached", "--name-only")
+	if err != nil || strings.TrimSpace(string(staged)) != "notes.txt" {
+		ts.Fatalf("unexpected index after the failed commit: %q, %v", staged, err)
+	}
+	status, _ := runGitCommandOutput(dir, "status", "--porcelain", "--untracked-files=no")
+	if strings.TrimSpace(string(status)) != "A  notes.txt" {
+		ts.Fatalf("working tree not clean after the rollback:\n%s", status)
+	}
+}
+
+func TestReleaseReportForZip(ts *testing.T) {
+	dir := ts.TempDir()
+	writeFile(ts, filepath.Join(dir, "plugin.php"), "<?php\n/*\n * Plugin Name: TestPlugin\n * Version: 1.1.0\n */\ndefine('TEST_VERSION', '1.0.0');\n")
+	updateInfoPath := filepath.Join(dir, "Updates", "update_info.json")
+	writeFile(ts, updateInfoPath, `{"name":"TestPlugin","version":"1.0.0","slug":"slug","download_url":"https://example.com/updates/slug-v1.0.0.zip"}`)
+	ui, all, err := getUpdateInfo(updateInfoPath)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	ctx := &releaseContext{
+		workDir:         dir,
+		opts:            &cliOptions{command: "zip"},
+		config:          ConfigType{MainPHPFile: "plugin.php"},
+		updateInfoPath:  updateInfoPath,
+		updateInfo:      ui,
+		allData:         all,
+		previousVersion: ui.Version,
+	}
+	if err := ctx.runCommand(findCommand("zip")); err != nil {
+		ts.Fatalf("zip command error: %v", err)
+	}
+
+	r := ctx.report(nil)
+	want := map[string]string{"header": "1.1.0", "define": "1.0.0", "update_info": "1.0.0"}
+	if !r.Success || r.Version != "1.1.0" || !reflect.DeepEqual(r.DetectedVersions, want) {
+		ts.Fatalf("unexpected report versions: %+v", r)
+	}
+	if r.Zip == nil || filepath.Base(r.Zip.Path) != "slug-v1.1.0.zip" || !reflect.DeepEqual(r.Zip.Files, []string{"slug/plugin.php"}) {
+		ts.Fatalf("unexpected ZIP report: %+v", r.Zip)
+	}
+	size, sum, err := fileSHA256(r.Zip.Path)
+	if err != nil || r.Zip.Size != size || r.Zip.SHA256 != sum || len(sum) != 64 {
+		ts.Fatalf("unexpected ZIP checksum: %+v, %v", r.Zip, err)
+	}
+	if r.Upload != nil || r.Git != nil {
+		ts.Fatalf("zip command must not report upload or git: %+v", r)
+	}
+}
+
+func TestInitScaffoldsPlugin(ts *testing.T) {
+	nonInteractive = true
+	defer func() { nonInteractive = false }()
+
+	dir := filepath.Join(ts.TempDir(), "my-plugin")
+	writeFile(ts, filepath.Join(dir, "helper.php"), "<?php\n// Helper: functions\n")
+	writeFile(ts, filepath.Join(dir, "my-plugin.php"), "<?php\n/**\n * Plugin Name: My Plugin\n * Version: 1.0.0\n */\n\ndefined('ABSPATH') || exit;\n\nadd_action('init', 'my_init');\n")
+
+	opts := &cliOptions{initUpdateURL: "https://updates.example.com/my-plugin/", initSSH: "deploy@example.com:2222", initSSHDir: "/srv/www"}
+	if err := runInit(dir, opts); err != nil {
+		ts.Fatalf("runInit error: %v", err)
+	}
+
+	var cfg initConfig
+	raw, _ := os.ReadFile(filepath.Join(dir, "update.config"))
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		ts.Fatalf("update.config is no JSON: %v", err)
+	}
+	if cfg.MainPHPFile != "my-plugin.php" || cfg.SSHUser != "deploy" || cfg.SSHHost != "example.com" || cfg.SSHPort != "2222" || cfg.SSHDirBase != "/srv/www" {
+		ts.Fatalf("unexpected update.config: %+v", cfg)
 	}
+	ui, _, err := getUpdateInfo(filepath.Join(dir, "Updates", "update_info.json"))
+	if err != nil || ui.DownloadURL != "https://updates.example.com/my-plugin/my-plugin-v1.0.0.zip" || ui.Slug != "my-plugin" || ui.Name != "My Plugin" {
+		ts.Fatalf("unexpected update_info.json: %+v, %v", ui, err)
+	}
+
+	// The generated bootstrap must be accepted by the release process and sit
+	// behind the ABSPATH guard.
+	php, _ := os.ReadFile(filepath.Join(dir, "my-plugin.php"))
+	if strings.Index(string(php), "buildUpdateChecker") < strings.Index(string(php), "ABSPATH") {
+		ts.Fatalf("bootstrap inserted before the ABSPATH guard:\n%s", php)
+	}
+	if _, err := processMainPHPFile(dir, "my-plugin.php", ui, "", "", "", "2026-01-02 03:04:05"); err != nil {
+		ts.Fatalf("processMainPHPFile error: %v", err)
+	}
+	if err := syncPUCCall(dir, "my-plugin.php", ui, "update_info.json"); err != nil {
+		ts.Fatalf("generated bootstrap not accepted: %v", err)
+	}
+
+	if err := runInit(dir, opts); err == nil {
+		ts.Fatal("expected init to refuse an existing update.config")
+	}
+
+	// "Plugin Name:" in a string before the header is not the header.
+	content := "<?php\n$label = 'Plugin Name: */';\n/**\n * Plugin Name: P\n */\n\nadd_action('init', 'p_init');\n"
+	out, ok := insertPUCSnippet(content, "SNIPPET\n")
+	if !ok || !strings.Contains(out, " */\nSNIPPET\n\nadd_action") {
+		ts.Fatalf("snippet not inserted after the header:\n%s", out)
+	}
+
+	// A failed init leaves nothing behind and can be run again.
+	dir = filepath.Join(ts.TempDir(), "line-plugin")
+	writeFile(ts, filepath.Join(dir, "line-plugin.php"), "<?php\n// Plugin Name: Line Plugin\n// Version: 1.0.0\n")
+	if err := runInit(dir, opts); err == nil {
+		ts.Fatal("expected init to fail without a header block")
+	}
+	for _, name := range []string{"update.config", "Updates"} {
+		if fileExists(filepath.Join(dir, name)) {
+			ts.Fatalf("%s left behind by a failed init", name)
+		}
+	}
+	if err := runInit(dir, opts); err == nil || strings.Contains(err.Error(), "update.config") {
+		ts.Fatalf("rerun not possible: %v", err)
+	}
+}
 
-	_, _, _, verboseFlag = parseCLIArgs([]string{"-v", "."})
-	if !verboseFlag {
-		ts.Fatal("expected -v to enable verbose")
+func TestSyncReadmeTxt(ts *testing.T) {
+	dir := ts.TempDir()
+	readme := `=== My Plugin ===
+Contributors: jan
+Requires at least: 5.0
+Tested up to: 6.0
+Stable tag: 1.0.0
+License: GPLv2
+
+Short description.
+
+== Changelog ==
+
+= 1.0.0 =
+* First release
+
+== Upgrade Notice ==
+
+= 1.0.0 =
+Initial.
+`
+	writeFile(ts, filepath.Join(dir, "readme.txt"), readme)
+	ui := &UpdateInfo{TestedWP: "6.5", RequiresPHP: "7.4"}
+
+	if err := syncReadmeTxt(dir, "1.1.0", ui, "- Fixed settings\n- Faster load"); err != nil {
+		ts.Fatalf("syncReadmeTxt error: %v", err)
+	}
+	// A second run with the same text must not add the entry again.
+	if err := syncReadmeTxt(dir, "1.1.0", ui, "- Fixed settings\n- Faster load"); err != nil {
+		ts.Fatalf("syncReadmeTxt error: %v", err)
+	}
+	want := `=== My Plugin ===
+Contributors: jan
+Requires at least: 5.0
+Tested up to: 6.5
+Stable tag: 1.1.0
+License: GPLv2
+Requires PHP: 7.4
+
+Short description.
+
+== Changelog ==
+
+= 1.1.0 =
+* Fixed settings
+* Faster load
+
+= 1.0.0 =
+* First release
+
+== Upgrade Notice ==
+
+= 1.0.0 =
+Initial.
+`
+	got, _ := os.ReadFile(filepath.Join(dir, "readme.txt"))
+	if string(got) != want {
+		ts.Fatalf("unexpected readme.txt:\n%s", got)
+	}
+}
+
+func TestSyncPluginHeader(ts *testing.T) {
+	php := `<?php
+/**
+ * Plugin Name: My Plugin
+ * Plugin URI: https://example.com/my-plugin
+ * Author: Jan
+ * Requires at least: 6.0
+ * Version: 1.0.0
+ */
+`
+	ui := &UpdateInfo{Name: "Old Name", RequiresWP: "5.0", RequiresPHP: "8.1"}
+	out, err := syncPluginHeader(php, ui, "header")
+	if err != nil || out != php {
+		ts.Fatalf("header mode must not change the PHP file: %v\n%s", err, out)
+	}
+	if ui.Name != "My Plugin" || ui.Homepage != "https://example.com/my-plugin" || ui.Author != "Jan" || ui.RequiresWP != "6.0" || ui.RequiresPHP != "8.1" {
+		ts.Fatalf("unexpected update info after header sync: %+v", ui)
+	}
+
+	ui = &UpdateInfo{Name: "New Name", RequiresPHP: "8.1"}
+	out, err = syncPluginHeader(php, ui, "update_info")
+	if err != nil {
+		ts.Fatalf("syncPluginHeader error: %v", err)
+	}
+	header := parsePluginHeader(out)
+	if header["Plugin Name"] != "New Name" || header["Requires PHP"] != "8.1" || header["Author"] != "Jan" || !strings.Contains(out, " * Requires PHP: 8.1\n */") {
+		ts.Fatalf("unexpected header after update_info sync:\n%s", out)
+	}
+
+	if _, err := syncPluginHeader(php, ui, "both"); err == nil {
+		ts.Fatal("expected error for unknown metadata_source")
+	}
+}
+
+func TestVersionLocations(ts *testing.T) {
+	dir := ts.TempDir()
+	packageJSON := "{\n    \"name\": \"my-plugin\",\n    \"config\": {\"version\": \"0.1\"},\n    \"version\": \"1.2.0\"\n}\n"
+	writeFile(ts, filepath.Join(dir, "package.json"), packageJSON)
+	writeFile(ts, filepath.Join(dir, "includes", "class-api.php"), "<?php\nclass Api {\n\tconst VERSION = '1.3.0';\n}\n")
+	writeFile(ts, filepath.Join(dir, "readme.md"), "Current release: v1.1.0\n")
+	initLogging(dir)
+	defer logFile.Close()
+
+	locations := []VersionLocation{
+		{File: "package.json", Type: "json:version"},
+		{File: "includes/class-api.php", Type: "const:VERSION"},
+		{File: "readme.md", Pattern: `release: v(\S+)`},
+	}
+	found, err := readVersionLocations(dir, locations)
+	if err != nil {
+		ts.Fatalf("readVersionLocations error: %v", err)
+	}
+	if len(found) != 3 || found[0].version != "1.2.0" || found[1].version != "1.3.0" || found[2].version != "1.1.0" {
+		ts.Fatalf("unexpected versions: %+v", found)
+	}
+	if got := highestLocationVersion(found); got != "1.3.0" {
+		ts.Fatalf("highestLocationVersion=%q want 1.3.0", got)
+	}
+
+	if err := syncVersionLocations(dir, locations, "1.3.0"); err != nil {
+		ts.Fatalf("syncVersionLocations error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "package.json"))
+	if want := strings.Replace(packageJSON, "1.2.0", "1.3.0", 1); string(b) != want {
+		ts.Fatalf("package.json not updated in place:\n%s", b)
+	}
+	b, _ = os.ReadFile(filepath.Join(dir, "readme.md"))
+	if string(b) != "Current release: v1.3.0\n" {
+		ts.Fatalf("pattern location not updated: %q", b)
+	}
+
+	if _, err := readVersionLocations(dir, []VersionLocation{{File: "readme.md", Pattern: `v\S+`}}); err == nil {
+		ts.Fatal("expected error for a pattern without group")
+	}
+	if _, err := readVersionLocations(dir, []VersionLocation{{File: "package.json", Type: "json:extra.version"}}); err == nil {
+		ts.Fatal("expected error for a missing JSON key")
+	}
+}
+
+func TestBlockVersionsAndAssets(ts *testing.T) {
+	dir := ts.TempDir()
+	writeFile(ts, filepath.Join(dir, "src", "hero", "block.json"), "{\n\t\"name\": \"my/hero\",\n\t\"version\": \"1.0.0\"\n}\n")
+	writeFile(ts, filepath.Join(dir, "build", "hero", "block.json"), "{\n  \"name\": \"my/hero\"\n}\n")
+	writeFile(ts, filepath.Join(dir, "node_modules", "pkg", "block.json"), "{\"version\": \"0.1.0\"}")
+	writeFile(ts, filepath.Join(dir, "src", "hero", "index.js"), "export default {};")
+	writeFile(ts, filepath.Join(dir, "build", "hero", "index.asset.php"), "<?php return array();")
+	initLogging(dir)
+	defer logFile.Close()
+
+	if err := syncBlockVersions(dir, nil, "1.1.0"); err != nil {
+		ts.Fatalf("syncBlockVersions error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "src", "hero", "block.json"))
+	if string(b) != "{\n\t\"name\": \"my/hero\",\n\t\"version\": \"1.1.0\"\n}\n" {
+		ts.Fatalf("unexpected src block.json:\n%s", b)
+	}
+	b, _ = os.ReadFile(filepath.Join(dir, "build", "hero", "block.json"))
+	if string(b) != "{\n  \"version\": \"1.1.0\",\n  \"name\": \"my/hero\"\n}\n" {
+		ts.Fatalf("unexpected build block.json:\n%s", b)
+	}
+	b, _ = os.ReadFile(filepath.Join(dir, "node_modules", "pkg", "block.json"))
+	if !strings.Contains(string(b), "0.1.0") {
+		ts.Fatalf("block.json of a dependency changed: %s", b)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "build", "hero", "index.asset.php"), old, old); err != nil {
+		ts.Fatalf("chtimes: %v", err)
+	}
+	if err := checkBlockAssets(dir); err == nil {
+		ts.Fatal("expected error for an asset older than its source")
+	}
+	// The release stops before block.json is touched.
+	ctx := &releaseContext{workDir: dir, opts: &cliOptions{command: "release", bumpLevel: "minor"}}
+	if err := runRelease(ctx); err == nil || !strings.Contains(err.Error(), "index.asset.php") {
+		ts.Fatalf("expected the release to refuse outdated assets, got %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "src", "hero", "block.json")); !strings.Contains(string(b), "1.1.0") {
+		ts.Fatalf("block.json changed by a refused release: %s", b)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "src", "hero", "index.js"), old.Add(-time.Hour), old.Add(-time.Hour)); err != nil {
+		ts.Fatalf("chtimes: %v", err)
+	}
+	if err := checkBlockAssets(dir); err != nil {
+		ts.Fatalf("checkBlockAssets error: %v", err)
+	}
+}
+
+func TestVerifyVersions(ts *testing.T) {
+	dir := ts.TempDir()
+	php := "<?php\n/*\n * Plugin Name: TestPlugin\n * Version: 1.2.0\n */\ndefine('TEST_VERSION', '1.2.0');\n"
+	writeFile(ts, filepath.Join(dir, "plugin.php"), php)
+	writeFile(ts, filepath.Join(dir, "Changelog.md"), "# Changelog\n\n## [Unreleased]\n\n## [1.2.0] - 2026-01-01\n\n- Fix\n")
+	updateInfoPath := filepath.Join(dir, "Updates", "update_info.json")
+	writeFile(ts, updateInfoPath, `{"version":"1.2.0","slug":"slug","download_url":"https://example.com/updates/slug-v1.1.0.zip"}`)
+	initLogging(dir)
+	defer logFile.Close()
+
+	ui, all, err := getUpdateInfo(updateInfoPath)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	ctx := &releaseContext{
+		workDir:        dir,
+		opts:           &cliOptions{command: "verify"},
+		config:         ConfigType{MainPHPFile: "plugin.php"},
+		updateInfoPath: updateInfoPath,
+		updateInfo:     ui,
+		allData:        all,
+	}
+	if err := ctx.runCommand(findCommand("verify")); err == nil {
+		ts.Fatal("expected error for the ZIP of an older version")
+	}
+	if ctx.rolledBack {
+		ts.Fatal("a failed verify must not roll back")
+	}
+	want := map[string]string{"header": "1.2.0", "define": "1.2.0", "update_info": "1.2.0", "changelog": "1.2.0", "download_url": "1.1.0"}
+	if !reflect.DeepEqual(ctx.detectedVersions, want) {
+		ts.Fatalf("unexpected versions: %+v", ctx.detectedVersions)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "plugin.php")); string(b) != php {
+		ts.Fatalf("verify changed the PHP file:\n%s", b)
+	}
+
+	ui.DownloadURL = "https://example.com/updates/slug-v1.2.0.zip"
+	if err := ctx.runCommand(findCommand("verify")); err != nil {
+		ts.Fatalf("verify error: %v", err)
+	}
+}
+
+func TestChangelogReleaseThenVerify(ts *testing.T) {
+	dir := ts.TempDir()
+	writeFile(ts, filepath.Join(dir, "plugin.php"), "<?php\n/*\n * Plugin Name: TestPlugin\n * Version: 1.3.0\n */\n")
+	writeFile(ts, filepath.Join(dir, "Changelog.md"), "# Changelog\n\n## [1.2.0] - 2026-01-01\n\n- Fix\n")
+	updateInfoPath := filepath.Join(dir, "Updates", "update_info.json")
+	writeFile(ts, updateInfoPath, `{"version":"1.3.0","slug":"slug","download_url":"https://example.com/updates/slug-v1.3.0.zip"}`)
+	initLogging(dir)
+	defer logFile.Close()
+
+	if _, err := processChangelog(dir, "1.3.0", "New feature"); err != nil {
+		ts.Fatalf("processChangelog error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "Changelog.md"))
+	if !regexp.MustCompile(`(?s)^# Changelog\n\n## \[1\.3\.0\] - \S+\n\n- New feature\n\n## \[1\.2\.0\] - 2026-01-01\n\n- Fix\n`).Match(b) {
+		ts.Fatalf("new section not above the previous one:\n%s", b)
+	}
+
+	ui, all, err := getUpdateInfo(updateInfoPath)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	ctx := &releaseContext{
+		workDir:        dir,
+		opts:           &cliOptions{command: "verify"},
+		config:         ConfigType{MainPHPFile: "plugin.php"},
+		updateInfoPath: updateInfoPath,
+		updateInfo:     ui,
+		allData:        all,
+	}
+	if err := ctx.runCommand(findCommand("verify")); err != nil {
+		ts.Fatalf("verify after the changelog step: %v (%+v)", err, ctx.detectedVersions)
+	}
+}
+
+func TestPHPLexerFindsRealHeader(ts *testing.T) {
+	php := `<?php
+$doc = "/* Version: 9.9.9 */";
+/**
+ * Plugin Name:  My Plugin
+ * Version:      1.2.0
+ */
+// define('OLD_VERSION', '0.1.0');
+$text = <<<EOT
+private $version = '8.8.8';
+EOT;
+define( 'MY_VERSION', "1.2.0" );
+class My_Plugin {
+	protected static $version = '1.1.0';
+}
+/**
+ * Bundled library
+ * Version: 3.0.0
+ */
+`
+	v := findPHPVersions(php)
+	if v.comment != "1.2.0" || v.class != "1.1.0" || v.define != "1.2.0" || v.defineKey != "MY" {
+		ts.Fatalf("unexpected versions: %+v", v)
+	}
+	if php[v.classPos[0]:v.classPos[1]] != "1.1.0" || php[v.definePos[0]:v.definePos[1]] != "1.2.0" {
+		ts.Fatalf("unexpected positions: %+v", v)
+	}
+
+	out, added, ok := setHeaderLastUpdate(php, "2026-01-02 03:04:05")
+	if !ok || !added || !strings.Contains(out, " * Version:      1.2.0\n * Last-Update:  2026-01-02 03:04:05\n */") {
+		ts.Fatalf("Last-Update not added in header style:\n%s", out)
+	}
+	if strings.Count(out, "Last-Update") != 1 {
+		ts.Fatalf("Last-Update added outside the header:\n%s", out)
+	}
+	out, added, ok = setHeaderLastUpdate(out, "2026-02-03 04:05:06")
+	if !ok || added || !strings.Contains(out, " * Last-Update:  2026-02-03 04:05:06\n") {
+		ts.Fatalf("Last-Update not updated:\n%s", out)
+	}
+	for _, date := range []string{"2026-02-02T03:04:05Z", "03.02.2026 04:05", "2026-03-04T05:06:07Z"} {
+		out, added, ok = setHeaderLastUpdate(out, date)
+		if !ok || added || strings.Count(out, "Last-Update") != 1 || !strings.Contains(out, " * Last-Update:  "+date+"\n */") {
+			ts.Fatalf("Last-Update not replaced with %q:\n%s", date, out)
+		}
+	}
+
+	lineHeader := "<?php\n// Plugin Name: Lines\n// Version: 2.0\n\necho 'Version: 5.0';\n"
+	if v := findPHPVersions(lineHeader); v.comment != "2.0" {
+		ts.Fatalf("line comment header not found: %+v", v)
+	}
+}
+
+func TestFindPUCCallShapes(ts *testing.T) {
+	cases := []struct{ php, url, slug string }{
+		{`<?php $c = Puc_v4_Factory::buildUpdateChecker('https://a.example/u.json', __FILE__, 'slug-a');`, "https://a.example/u.json", "slug-a"},
+		{"<?php\n$c = \\YahnisElsts\\PluginUpdateChecker\\v5\\PucFactory::buildUpdateChecker(\n\t\"https://b.example/u.json\",\n\tplugin_dir_path(__FILE__) . 'main.php', // main file\n\t\"slug-b\"\n);", "https://b.example/u.json", "slug-b"},
+		{"<?php\ndefine('MY_UPDATE_URL', 'https://c.example/u.json');\n// PucFactory::buildUpdateChecker('https://old.example', __FILE__, 'old');\n$c = PucFactory::buildUpdateChecker(MY_UPDATE_URL, dirname(__FILE__) . '/main.php');", "https://c.example/u.json", ""},
+		{"<?php\nuse YahnisElsts\\PluginUpdateChecker\\v5\\PucFactory as Updater;\n$c = Updater::buildUpdateChecker('https://d.example/u.json', __FILE__, 'slug-d');", "https://d.example/u.json", "slug-d"},
+	}
+	for _, c := range cases {
+		call, ok := findPUCCall(c.php)
+		if !ok || call.url != c.url || call.slug != c.slug {
+			ts.Fatalf("findPUCCall(%q)=%+v,%v want %q,%q", c.php, call, ok, c.url, c.slug)
+		}
+	}
+	if _, ok := findPUCCall("<?php\n/* PucFactory::buildUpdateChecker('x', __FILE__, 'y'); */\n"); ok {
+		ts.Fatal("PUC call in a comment must be ignored")
+	}
+
+	dir := ts.TempDir()
+	writeFile(ts, filepath.Join(dir, "includes", "updater.php"), "<?php\ndefine('MY_UPDATE_URL', \"https://c.example/updates/old.json\");\n$c = PucFactory::buildUpdateChecker(MY_UPDATE_URL, __FILE__, \"old\");\n")
+	initLogging(dir)
+	defer logFile.Close()
+	ui := &UpdateInfo{DownloadURL: "https://c.example/updates/slug-v1.0.0.zip", Slug: "slug"}
+	if err := syncPUCCall(dir, "includes/updater.php", ui, "update_info.json"); err != nil {
+		ts.Fatalf("syncPUCCall error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "includes", "updater.php"))
+	want := "<?php\ndefine('MY_UPDATE_URL', \"https://c.example/updates/update_info.json\");\n$c = PucFactory::buildUpdateChecker(MY_UPDATE_URL, __FILE__, \"slug\");\n"
+	if string(b) != want {
+		ts.Fatalf("unexpected updater.php:\n%s", b)
+	}
+
+	disabled := false
+	cfg := ConfigType{MainPHPFile: "main.php", PUC: &disabled}
+	if cfg.pucEnabled() || cfg.pucFile() != "main.php" {
+		ts.Fatalf("unexpected PUC config: %v %q", cfg.pucEnabled(), cfg.pucFile())
+	}
+}
+
+func TestThemeRelease(ts *testing.T) {
+	dir := filepath.Join(ts.TempDir(), "my-theme")
+	css := "/*\nTheme Name: My Theme\nTheme URI: https://example.com/my-theme\nVersion: 2.0.0\n*/\n\n#header { content: \"Version: 9.9.9\"; }\n"
+	writeFile(ts, filepath.Join(dir, "style.css"), css)
+	writeFile(ts, filepath.Join(dir, "functions.php"), "<?php\n$c = PucFactory::buildUpdateChecker('https://example.com/themes/old.json', __FILE__);\n")
+	updateInfoPath := filepath.Join(dir, "Updates", "update_info.json")
+	writeFile(ts, updateInfoPath, `{"version":"2.0.0","details_url":"https://example.com/my-theme","download_url":"https://example.com/themes/my-theme-v2.0.0.zip"}`)
+	initLogging(dir)
+	defer logFile.Close()
+
+	ui, all, err := getUpdateInfo(updateInfoPath)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	ctx := &releaseContext{
+		workDir:        dir,
+		opts:           &cliOptions{command: "bump", bumpLevel: "minor"},
+		config:         ConfigType{Type: "theme"},
+		updateInfoPath: updateInfoPath,
+		updateInfo:     ui,
+		allData:        all,
+	}
+	if err := ctx.runCommand(findCommand("bump")); err != nil {
+		ts.Fatalf("bump error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "style.css"))
+	if !strings.Contains(string(b), "Version: 2.1.0\nLast-Update: ") || !strings.Contains(string(b), "\"Version: 9.9.9\"") {
+		ts.Fatalf("unexpected style.css:\n%s", b)
+	}
+	if ui.Name != "My Theme" || ui.Homepage != "https://example.com/my-theme" {
+		ts.Fatalf("theme header not synchronized: %+v", ui)
+	}
+	b, _ = os.ReadFile(filepath.Join(dir, "functions.php"))
+	if !strings.Contains(string(b), "'https://example.com/themes/update_info.json'") {
+		ts.Fatalf("theme PUC bootstrap not updated:\n%s", b)
+	}
+
+	ctx.opts = &cliOptions{command: "zip"}
+	if err := ctx.runCommand(findCommand("zip")); err != nil {
+		ts.Fatalf("zip error: %v", err)
+	}
+	if filepath.Base(ctx.zipPath) != "my-theme-v2.1.0.zip" || !reflect.DeepEqual(ctx.zipFiles, []string{"my-theme/Changelog.md", "my-theme/functions.php", "my-theme/style.css"}) {
+		ts.Fatalf("unexpected theme ZIP %s: %v", ctx.zipPath, ctx.zipFiles)
+	}
+	if ui.Slug != "" {
+		ts.Fatalf("theme update_info got a slug: %q", ui.Slug)
+	}
+}
+
+func TestReleaseTimestamp(ts *testing.T) {
+	ts.Setenv("SOURCE_DATE_EPOCH", "1767322800")
+
+	config := ConfigType{}
+	if got, err := config.releaseTimestamp(); err != nil || got != "2026-01-02 03:00:00" {
+		ts.Fatalf("default timestamp = %q, %v", got, err)
+	}
+	config.TimestampFormat = time.RFC3339
+	if got, err := config.releaseTimestamp(); err != nil || got != "2026-01-02T03:00:00Z" {
+		ts.Fatalf("RFC 3339 timestamp = %q, %v", got, err)
+	}
+	config.Timezone = "No/Such_Zone"
+	if _, err := config.releaseTimestamp(); err == nil {
+		ts.Fatalf("expected error for an unknown timezone")
+	}
+
+	ts.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	config.Timezone = ""
+	if _, err := config.releaseTimestamp(); err == nil {
+		ts.Fatalf("expected error for an invalid SOURCE_DATE_EPOCH")
+	}
+}
+
+func TestValidateUpdateInfo(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	valid := `{
+  "name": "My Plugin",
+  "version": "1.2.0",
+  "download_url": "https://example.com/updates/my-plugin-v1.2.0.zip",
+  "tested": "6.4",
+  "requires_php": "8.1",
+  "sections": {"changelog": "<ul></ul>"},
+  "custom": [1, 2]
+}`
+	if issues := validateUpdateInfoData([]byte(valid)); len(issues) != 0 {
+		ts.Fatalf("unexpected issues: %+v", issues)
+	}
+	theme := `{"version":"1.0.0","details_url":"https://example.com/theme","download_url":"https://example.com/theme.zip"}`
+	if issues := validateUpdateInfoData([]byte(theme)); len(issues) != 0 {
+		ts.Fatalf("theme format without name rejected: %+v", issues)
+	}
+
+	invalid := `{
+  "version": "1.2.0",
+  "download_url": "updates/my-plugin.zip",
+  "tested": "latest",
+  "sections": {
+    "description": "ok",
+    "changelog": ["1.2.0"]
+  }
+}`
+	var got []string
+	for _, issue := range validateUpdateInfoData([]byte(invalid)) {
+		got = append(got, fmt.Sprintf("%d %s", issue.line, issue.field))
+	}
+	want := []string{"0 name", "3 download_url", "4 tested", "7 sections.changelog"}
+	if !reflect.DeepEqual(got, want) {
+		ts.Fatalf("issues = %v, want %v", got, want)
+	}
+
+	if issues := validateUpdateInfoData([]byte("{\n  \"version\": \"1.0.0\",\n}")); len(issues) != 1 || issues[0].line != 3 || issues[0].column != 1 {
+		ts.Fatalf("syntax error not reported with its position: %+v", issues)
+	}
+
+	path := filepath.Join(dir, "Updates", "update_info.json")
+	writeFile(ts, path, "{\n  \"name\": \"My Plugin\",\n  \"version\": 1.2\n}")
+	if _, _, err := getUpdateInfo(path); err == nil || !strings.Contains(err.Error(), "update_info.json:3: version: ") {
+		ts.Fatalf("expected a line-and-field error, got %v", err)
+	}
+	writeFile(ts, path, invalid)
+	ctx := &releaseContext{workDir: dir, opts: &cliOptions{command: "validate"}, updateInfoPath: path}
+	if err := runValidate(ctx); err == nil || !strings.Contains(err.Error(), "update_info.json:3: download_url: ") {
+		ts.Fatalf("validate command accepted an invalid file: %v", err)
+	}
+	writeFile(ts, path, valid)
+	if err := runValidate(ctx); err != nil {
+		ts.Fatalf("validate command error: %v", err)
+	}
+
+	// A syntax error still reaches the validate command.
+	writeFile(ts, filepath.Join(dir, "update.config"), `{"main_php_file": "my-plugin.php"}`)
+	writeFile(ts, path, "{\n  \"name\": \"My Plugin\"\n  \"version\": \"1.2.0\"\n}")
+	ctx, err := newReleaseContext(dir, &cliOptions{command: "validate"})
+	if err != nil {
+		ts.Fatalf("newReleaseContext error: %v", err)
+	}
+	if err := runValidate(ctx); err == nil || !strings.Contains(err.Error(), "update_info.json:3:3: invalid character") {
+		ts.Fatalf("expected a syntax error with line and column, got %v", err)
+	}
+}
+
+func TestSetUpdateInfoKeepsFormatting(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	path := filepath.Join(dir, "Updates", "update_info.json")
+	original := "{\n\t\"name\": \"My Plugin\",\n\t\"version\": \"1.0.0\",\n\t\"custom\": {\"b\": 1, \"a\": [1,2]},\n" +
+		"\t\"download_url\": \"https://example.com/my-plugin-v1.0.0.zip\",\n" +
+		"\t\"sections\": {\n\t\t\"description\": \"<p>Plugin</p>\",\n\t\t\"changelog\": \"old\"\n\t},\n" +
+		"\t\"last_updated\": \"2024-01-01 00:00:00\"\n}\n"
+	writeFile(ts, path, original)
+	ui, all, err := getUpdateInfo(path)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	ui.Version = "1.1.0"
+	ui.LastUpdated = "2026-01-02 03:04:05"
+	ui.DownloadURL = "https://example.com/my-plugin-v1.1.0.zip"
+	ui.Sections["changelog"] = "<ul><li>new</li></ul>"
+	ui.RequiresPHP = "8.1"
+	if err := setUpdateInfo(ui, all, path); err != nil {
+		ts.Fatalf("setUpdateInfo error: %v", err)
+	}
+
+	want := "{\n\t\"name\": \"My Plugin\",\n\t\"version\": \"1.1.0\",\n\t\"custom\": {\"b\": 1, \"a\": [1,2]},\n" +
+		"\t\"download_url\": \"https://example.com/my-plugin-v1.1.0.zip\",\n" +
+		"\t\"sections\": {\n\t\t\"description\": \"<p>Plugin</p>\",\n\t\t\"changelog\": \"<ul><li>new</li></ul>\"\n\t},\n" +
+		"\t\"last_updated\": \"2026-01-02 03:04:05\",\n\t\"requires_php\": \"8.1\"\n}\n"
+	if b, _ := os.ReadFile(path); string(b) != want {
+		ts.Fatalf("unexpected update_info.json:\n%s", b)
+	}
+
+	patched, ok := patchJSONDocument([]byte(`{"a": 1, "b": 2, "c": {"d": 3}}`), map[string]interface{}{"b": 2, "c": map[string]interface{}{"d": 4, "e": "x"}})
+	if !ok || string(patched) != `{"b": 2, "c": {"d": 4, "e": "x"}}` {
+		ts.Fatalf("unexpected compact patch: %s", patched)
+	}
+}
+
+func TestUpdateInfoExtraAndMerge(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	path := filepath.Join(dir, "Updates", "update_info.json")
+	writeFile(ts, path, `{
+  "name": "My Plugin",
+  "version": "1.0.0",
+  "download_url": "https://example.com/my-plugin-v1.0.0.zip",
+  "banners": {"low": "https://example.com/low.png", "meta": {"alt": "Banner"}},
+  "sections": {"description": "Plugin", "faq": "Old answers"},
+  "x_license": {"server": "https://example.com/licenses"},
+  "x_obsolete": true
+}`)
+	ui, all, err := getUpdateInfo(path)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	if ui.Banners["low"] != "https://example.com/low.png" || ui.Extra["x_license"] == nil || ui.Extra["name"] != nil {
+		ts.Fatalf("unexpected UpdateInfo: %+v", ui)
+	}
+
+	ui.Banners = map[string]string{"high": "https://example.com/high.png"}
+	delete(ui.Sections, "faq")
+	ui.Extra["x_license"] = map[string]interface{}{"product": "my-plugin"}
+	ui.Extra["x_channel"] = "stable"
+	delete(ui.Extra, "x_obsolete")
+	if err := setUpdateInfo(ui, all, path); err != nil {
+		ts.Fatalf("setUpdateInfo error: %v", err)
+	}
+	var got map[string]interface{}
+	b, _ := os.ReadFile(path)
+	if err := json.Unmarshal(b, &got); err != nil {
+		ts.Fatalf("invalid update_info.json: %v", err)
+	}
+	banners, _ := got["banners"].(map[string]interface{})
+	if banners["low"] != nil || banners["high"] == nil || banners["meta"] == nil {
+		ts.Fatalf("banners not replaced: %s", b)
+	}
+	sections, _ := got["sections"].(map[string]interface{})
+	if sections["faq"] != nil || sections["description"] != "Plugin" {
+		ts.Fatalf("removed section kept: %s", b)
+	}
+	license, _ := got["x_license"].(map[string]interface{})
+	if license["server"] == nil || license["product"] != "my-plugin" || got["x_channel"] != "stable" || got["x_obsolete"] != nil {
+		ts.Fatalf("Extra not merged: %s", b)
+	}
+}
+
+func TestMarkdownToHTML(ts *testing.T) {
+	md := "# Title\n\nSome **bold** and *em* text with `a<b>` and a [link](https://example.com/?a=1&b=2).\nSecond line  \nafter break\n\n" +
+		"- one\n- two\n  continued\n\n1. first\n2. second\n\n> quoted\n\n```\n<?php echo 1;\n```\n\n[bad](javascript:void) snake_case_name <script>"
+	want := "<h1>Title</h1>" +
+		"<p>Some <strong>bold</strong> and <em>em</em> text with <code>a&lt;b&gt;</code> and a <a href=\"https://example.com/?a=1&amp;b=2\">link</a>. Second line<br>after break</p>" +
+		"<ul><li>one</li><li>two continued</li></ul><ol><li>first</li><li>second</li></ol>" +
+		"<blockquote><p>quoted</p></blockquote><pre><code>&lt;?php echo 1;</code></pre>" +
+		"<p>bad snake_case_name &lt;script&gt;</p>"
+	if got := markdownToHTML(md); got != want {
+		ts.Fatalf("markdownToHTML =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderSections(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	writeFile(ts, filepath.Join(dir, "readme.txt"), "=== My Plugin ===\nStable tag: 1.0.0\n\n== Description ==\nFrom readme.\n\n"+
+		"== Frequently Asked Questions ==\n= Does it work? =\nYes.\n\n== Changelog ==\n= 1.0.0 =\n* Initial\n")
+	writeFile(ts, filepath.Join(dir, "Updates", "sections", "description.md"), "From **Markdown**.\n")
+	writeFile(ts, filepath.Join(dir, "Updates", "sections", "installation.md"), "1. Upload\n2. Activate\n")
+
+	ctx := &releaseContext{workDir: dir, updateInfo: &UpdateInfo{Sections: map[string]string{"changelog": "<dl></dl>"}}}
+	ctx.renderSections()
+	want := map[string]string{
+		"changelog":    "<dl></dl>",
+		"description":  "<p>From <strong>Markdown</strong>.</p>",
+		"installation": "<ol><li>Upload</li><li>Activate</li></ol>",
+		"faq":          "<h4>Does it work?</h4><p>Yes.</p>",
+	}
+	if !reflect.DeepEqual(ctx.updateInfo.Sections, want) {
+		ts.Fatalf("unexpected sections: %#v", ctx.updateInfo.Sections)
+	}
+}
+
+func TestSyncScreenshots(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	for _, name := range []string{"screenshot-2.jpg", "screenshot-1.png", "screenshot-10.gif", "screenshot-x.png", "banner-772x250.png"} {
+		writeFile(ts, filepath.Join(dir, "Updates", name), "image")
+	}
+	writeFile(ts, filepath.Join(dir, "readme.txt"), "=== My Plugin ===\n\n== Screenshots ==\n\n1. Settings page\n2. Block editor\n")
+	writeFile(ts, filepath.Join(dir, "Updates", "screenshots.json"), `{"2": "The block in the editor"}`)
+
+	ui := &UpdateInfo{DownloadURL: "https://example.com/updates/my-plugin/my-plugin-v1.0.0.zip"}
+	if err := syncScreenshots(dir, ui); err != nil {
+		ts.Fatalf("syncScreenshots error: %v", err)
+	}
+	want := []map[string]string{
+		{"src": "https://example.com/updates/my-plugin/screenshot-1.png", "caption": "Settings page"},
+		{"src": "https://example.com/updates/my-plugin/screenshot-2.jpg", "caption": "The block in the editor"},
+		{"src": "https://example.com/updates/my-plugin/screenshot-10.gif"},
+	}
+	if !reflect.DeepEqual(ui.Screenshots, want) {
+		ts.Fatalf("unexpected screenshots: %v", ui.Screenshots)
+	}
+
+	items := collectUploadItems(filepath.Join(dir, "Updates", "my-plugin-v1.0.0.zip"), filepath.Join(dir, "Updates", "update_info.json"), dir, "/var/www/updates/my-plugin", ui)
+	var remote []string
+	for _, item := range items[2:] {
+		remote = append(remote, filepath.ToSlash(item.remotePath))
+	}
+	if !reflect.DeepEqual(remote, []string{"/var/www/updates/my-plugin/screenshot-1.png", "/var/www/updates/my-plugin/screenshot-2.jpg", "/var/www/updates/my-plugin/screenshot-10.gif"}) {
+		ts.Fatalf("unexpected upload items: %v", remote)
+	}
+}
+
+func TestUpgradeNotice(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	changelog := "# Changelog\n\n## [2.0.0] - 2026-01-02\n\n- New settings page\n\n### Upgrade Notice\n\nRe-save the settings\nafter updating.\n\n" +
+		"## [1.0.0] - 2025-01-01\n\n- Initial\n"
+	writeFile(ts, filepath.Join(dir, "Changelog.md"), changelog)
+
+	ctx := &releaseContext{workDir: dir, opts: &cliOptions{}, currentVersion: "2.0.0", updateInfo: &UpdateInfo{}}
+	ctx.syncUpgradeNotice()
+	if ctx.updateInfo.Upgrade_notice != "Re-save the settings after updating." {
+		ts.Fatalf("unexpected upgrade notice %q", ctx.updateInfo.Upgrade_notice)
+	}
+	if html, _ := buildChangelogDLFromFile(dir, 5); strings.Contains(html, "Re-save") || !strings.Contains(html, "New settings page") {
+		ts.Fatalf("upgrade notice in the changelog section: %s", html)
+	}
+
+	ctx.currentVersion = "1.0.0"
+	ctx.syncUpgradeNotice()
+	if ctx.updateInfo.Upgrade_notice != "" {
+		ts.Fatalf("notice of another version kept: %q", ctx.updateInfo.Upgrade_notice)
+	}
+
+	ctx.opts.upgradeNotice = "Requires PHP 8.1"
+	ctx.syncUpgradeNotice()
+	b, _ := os.ReadFile(filepath.Join(dir, "Changelog.md"))
+	want := strings.Replace(changelog, "- Initial\n", "- Initial\n\n### Upgrade Notice\n\nRequires PHP 8.1\n", 1)
+	if string(b) != want || ctx.updateInfo.Upgrade_notice != "Requires PHP 8.1" {
+		ts.Fatalf("unexpected Changelog.md:\n%s", b)
+	}
+	ctx.currentVersion = "2.0.0"
+	ctx.syncUpgradeNotice()
+	b, _ = os.ReadFile(filepath.Join(dir, "Changelog.md"))
+	want = strings.Replace(want, "Re-save the settings\nafter updating.\n", "Requires PHP 8.1\n", 1)
+	if string(b) != want {
+		ts.Fatalf("upgrade notice not replaced:\n%s", b)
+	}
+
+	path := filepath.Join(dir, "Updates", "update_info.json")
+	writeFile(ts, path, `{"name":"P","version":"1.0.0","download_url":"https://example.com/p.zip","upgrade_notice":"Old notice"}`)
+	ui, all, err := getUpdateInfo(path)
+	if err != nil {
+		ts.Fatalf("getUpdateInfo error: %v", err)
+	}
+	ui.Upgrade_notice = ""
+	if err := setUpdateInfo(ui, all, path); err != nil {
+		ts.Fatalf("setUpdateInfo error: %v", err)
+	}
+	if b, _ := os.ReadFile(path); strings.Contains(string(b), "upgrade_notice") {
+		ts.Fatalf("upgrade_notice not cleared: %s", b)
+	}
+}
+
+func TestChangelogKeepsUpgradeNotice(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+	nonInteractive = true
+	defer func() { nonInteractive = false }()
+
+	writeFile(ts, filepath.Join(dir, "Changelog.md"), "# Changelog\n\n## [2.0.0] - 2026-01-02\n\n- New page\n\n### Upgrade Notice\n\nBack up first.\n\n## [1.0.0] - 2025-01-01\n\n- Initial\n\n")
+	writeFile(ts, filepath.Join(dir, "readme.txt"), "=== P ===\nStable tag: 1.0.0\n\nShort.\n\n== Changelog ==\n\n= 1.0.0 =\n* Initial\n")
+
+	text, err := processChangelog(dir, "2.0.0", "")
+	if err != nil || text != "- New page" {
+		ts.Fatalf("processChangelog = %q, %v", text, err)
+	}
+	if notice, err := readUpgradeNotice(dir, "2.0.0"); err != nil || notice != "Back up first." {
+		ts.Fatalf("readUpgradeNotice = %q, %v", notice, err)
+	}
+	if err := syncReadmeTxt(dir, "2.0.0", &UpdateInfo{}, text); err != nil {
+		ts.Fatalf("syncReadmeTxt error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "readme.txt"))
+	if !strings.Contains(string(b), "= 2.0.0 =\n* New page\n\n= 1.0.0 =") || strings.Contains(string(b), "Back up") {
+		ts.Fatalf("unexpected readme.txt:\n%s", b)
+	}
+}
+
+func TestRecordRelease(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	writeFile(ts, filepath.Join(dir, "Changelog.md"), "# Changelog\n\n## [1.1.0] - 2026-01-02\n\n- Fix\n\n### Upgrade Notice\n\nBack up first.\n")
+	zipPath := filepath.Join(dir, "Updates", "my-plugin-v1.1.0.zip")
+	writeFile(ts, zipPath, "zip")
+	writeFile(ts, releaseHistoryPath(dir), `[{"version":"1.0.0","date":"2025-12-01 10:00:00","zip":"my-plugin-v1.0.0.zip","download_url":"https://example.com/my-plugin-v1.0.0.zip"}]`)
+
+	ctx := &releaseContext{
+		workDir:        dir,
+		opts:           &cliOptions{command: "release"},
+		updateInfo:     &UpdateInfo{DownloadURL: "https://example.com/my-plugin-v1.1.0.zip"},
+		currentVersion: "1.1.0",
+		timestamp:      "2026-01-02 03:04:05",
+		zipFileName:    "my-plugin-v1.1.0.zip",
+		zipPath:        zipPath,
+		gitCommit:      "abc123",
+		gitTag:         "v1.1.0",
+	}
+	ctx.recordRelease()
+
+	entries, err := readReleaseHistory(dir)
+	if err != nil || len(entries) != 2 {
+		ts.Fatalf("readReleaseHistory = %v, %v", entries, err)
+	}
+	got := entries[1]
+	if got.ReleasedBy == "" {
+		ts.Fatalf("release without releaser: %+v", got)
+	}
+	got.ReleasedBy = ""
+	want := releaseHistoryEntry{
+		Version:     "1.1.0",
+		Date:        "2026-01-02 03:04:05",
+		Zip:         "my-plugin-v1.1.0.zip",
+		Size:        3,
+		SHA256:      fmt.Sprintf("%x", sha256.Sum256([]byte("zip"))),
+		DownloadURL: "https://example.com/my-plugin-v1.1.0.zip",
+		Commit:      "abc123",
+		Tag:         "v1.1.0",
+		Changelog:   "- Fix",
+	}
+	if !reflect.DeepEqual(got, want) || entries[0].Version != "1.0.0" {
+		ts.Fatalf("unexpected history entry:\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestRecordReleaseWithoutGit(ts *testing.T) {
+	dir := ts.TempDir()
+	initLogging(dir)
+	defer logFile.Close()
+
+	// A GitHub remote alone does not mean the release was tagged.
+	writeFile(ts, filepath.Join(dir, ".git", "config"), "[remote \"origin\"]\n\turl = https://github.com/example/my-plugin.git\n")
+	zipPath := filepath.Join(dir, "Updates", "my-plugin-v1.1.0.zip")
+	writeFile(ts, zipPath, "zip")
+
+	ctx := &releaseContext{
+		workDir:        dir,
+		opts:           &cliOptions{command: "release"},
+		updateInfo:     &UpdateInfo{DownloadURL: "https://example.com/my-plugin-v1.1.0.zip"},
+		currentVersion: "1.1.0",
+		zipFileName:    "my-plugin-v1.1.0.zip",
+		zipPath:        zipPath,
+		gitStatus:      stageSkipped,
+	}
+	ctx.recordRelease()
+
+	entries, err := readReleaseHistory(dir)
+	if err != nil || len(entries) != 1 {
+		ts.Fatalf("readReleaseHistory = %v, %v", entries, err)
+	}
+	if entries[0].Commit != "" || entries[0].Tag != "" {
+		ts.Fatalf("release without git stage has commit %q and tag %q", entries[0].Commit, entries[0].Tag)
 	}
 }